@@ -0,0 +1,85 @@
+package concpool
+
+// aimd adjusts a pool's concurrency limit between min and max the way TCP
+// adjusts its congestion window: one more slot after every window of
+// successes, half the slots after a failure. It is guarded by the pool's
+// mutex.
+type aimd struct {
+	min, max int
+
+	// successes counts the successful tasks since the last adjustment.
+	successes int
+	// epoch is bumped by every decrease. Jobs remember the epoch they
+	// started in, so a burst of failures from tasks that were already
+	// running halves the limit only once.
+	epoch uint64
+
+	// history holds the limit after each adjustment, starting with the
+	// initial one.
+	history []int
+}
+
+// WithAIMD makes the pool adapt its concurrency limit to a downstream
+// resource that signals overload with errors: after every run of as many
+// successful tasks as the current limit, the limit goes up by one, up to
+// max, and after a failure it is halved, down to min. Failures of tasks
+// that started before the last decrease don't halve it again. The pool
+// starts at min, or at the limit set by WithMaxConcurrency if that lies
+// between min and max. See Pool.ConcurrencyHistory. It should not be
+// combined with NewAutoScaling, which adjusts the same limit.
+func WithAIMD(min, max int) Option {
+	return func(p *Pool) {
+		if min < 1 {
+			min = 1
+		}
+		if max < min {
+			max = min
+		}
+		p.aimd = &aimd{min: min, max: max}
+	}
+}
+
+// ConcurrencyHistory returns the concurrency limit of a pool created with
+// WithAIMD after each adjustment, starting with the initial limit. It
+// returns nil for other pools.
+func (p *Pool) ConcurrencyHistory() []int {
+	p.lazyInit()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.aimd == nil {
+		return nil
+	}
+	return append([]int(nil), p.aimd.history...)
+}
+
+// adjustConcurrency applies the outcome of t to the AIMD limit.
+func (p *Pool) adjustConcurrency(t *job, failed bool) {
+	if p.aimd == nil {
+		return
+	}
+
+	p.mu.Lock()
+	a := p.aimd
+	raised := false
+	switch {
+	case failed && t.epoch == a.epoch:
+		a.epoch++
+		a.successes = 0
+		p.maxCount = max(a.min, p.maxCount/2)
+		a.history = append(a.history, p.maxCount)
+	case !failed:
+		a.successes++
+		if a.successes >= p.maxCount && p.maxCount < a.max {
+			a.successes = 0
+			p.maxCount++
+			a.history = append(a.history, p.maxCount)
+			p.slotFreed.Broadcast()
+			raised = true
+		}
+	}
+	p.mu.Unlock()
+
+	if raised {
+		p.attemptCheck()
+	}
+}
@@ -0,0 +1,50 @@
+package concpool
+
+import (
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAIMD(t *testing.T) {
+	errOverloaded := errors.New("overloaded")
+	p := New(WithAIMD(1, 20))
+	// the downstream server fails requests beyond 5 at a time
+	var active atomic.Int32
+	for i := 0; i < 600; i++ {
+		p.Run(func() error {
+			n := active.Add(1)
+			defer active.Add(-1)
+			time.Sleep(time.Millisecond)
+			if n > 5 {
+				return errOverloaded
+			}
+			return nil
+		})
+	}
+	p.Wait()
+
+	// the limit probes past the server's capacity, is halved, and climbs
+	// back: a sawtooth around 5
+	history := p.ConcurrencyHistory()
+	if want := []int{1, 2, 3, 4, 5, 6}; len(history) < 20 || !slices.Equal(history[:6], want) {
+		t.Fatalf("ConcurrencyHistory() = %v, want it to start with %v", history, want)
+	}
+	sum := 0
+	for i, n := range history[6:] {
+		// slots aren't always all busy, so a probe can reach 7 before a
+		// task sees the overload
+		if n < 3 || n > 7 {
+			t.Fatalf("limit went to %d after %d adjustments, want it between 3 and 7: %v", n, i+6, history)
+		}
+		sum += n
+	}
+	if mean := float64(sum) / float64(len(history)-6); mean < 4 || mean > 6 {
+		t.Errorf("limit averaged %.1f, want about 5: %v", mean, history)
+	}
+	if h := New().ConcurrencyHistory(); h != nil {
+		t.Errorf("ConcurrencyHistory() without WithAIMD = %v, want nil", h)
+	}
+}
@@ -0,0 +1,141 @@
+package concpool
+
+import "time"
+
+// Defaults for NewAutoScaling.
+const (
+	defaultScaleUpThreshold = 0
+	defaultScaleDownDelay   = time.Second
+	defaultCheckInterval    = 100 * time.Millisecond
+)
+
+// ScaleOption configures how a pool created with NewAutoScaling adjusts
+// its concurrency.
+type ScaleOption func(*scaler)
+
+// WithScaleUpThreshold sets how many tasks may wait in the queue before the
+// pool adds a worker. The default of 0 adds one whenever a task has to wait.
+func WithScaleUpThreshold(n int) ScaleOption {
+	return func(s *scaler) {
+		if n < 0 {
+			n = 0
+		}
+		s.upThreshold = n
+	}
+}
+
+// WithScaleDownDelay sets how long the queue must stay empty with a worker
+// slot unused before the pool drops a worker. Each further step down waits
+// the same delay again. The default is one second.
+func WithScaleDownDelay(d time.Duration) ScaleOption {
+	return func(s *scaler) {
+		s.downDelay = d
+	}
+}
+
+// WithCheckInterval sets how often the pool looks at its queue to decide
+// whether to scale. The default is 100ms.
+func WithCheckInterval(d time.Duration) ScaleOption {
+	return func(s *scaler) {
+		if d > 0 {
+			s.interval = d
+		}
+	}
+}
+
+// scaler adjusts a pool's concurrency limit between min and max.
+type scaler struct {
+	min, max    int
+	upThreshold int
+	downDelay   time.Duration
+	interval    time.Duration
+
+	// idleSince is when the pool was last seen with an empty queue and a
+	// free slot; zero while it is busy. It is guarded by the pool's mutex.
+	idleSince time.Time
+}
+
+// NewAutoScaling creates a pool whose concurrency limit follows the load.
+// It starts at min and adds a worker at every check while the queue holds
+// more tasks than the scale-up threshold, up to max. When the queue is
+// empty and not every worker slot is in use, it gives a slot back after the
+// scale-down delay, down to min. Lowering the limit never interrupts a
+// running task. min is raised to 1 and max to min if needed.
+//
+// Scaling happens while the pool is working on a batch; between batches the
+// limit stays where it was. The current limit is reported by
+// MaxConcurrency and Stats.
+func NewAutoScaling(min, max int, opts ...ScaleOption) *Pool {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+
+	s := &scaler{
+		min:         min,
+		max:         max,
+		upThreshold: defaultScaleUpThreshold,
+		downDelay:   defaultScaleDownDelay,
+		interval:    defaultCheckInterval,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	p := New(WithMaxConcurrency(min), WithResultsBuffer(max))
+	p.scaler = s
+	return p
+}
+
+// run checks p every interval until stop is closed. The pool runs it for
+// as long as it has workers, i.e. from the first task of a batch until the
+// pool terminates.
+func (s *scaler) run(p *Pool, stop <-chan struct{}) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if s.check(p, time.Now()) {
+				p.checkQueue()
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// check moves the concurrency limit one step if the load calls for it and
+// reports whether it was raised.
+func (s *scaler) check(p *Pool, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pending := p.queue.len()
+	if pending > s.upThreshold {
+		s.idleSince = time.Time{}
+		if p.maxCount < s.max {
+			p.maxCount++
+			p.slotFreed.Broadcast()
+			return true
+		}
+		return false
+	}
+
+	if pending > 0 || p.running >= p.maxCount {
+		s.idleSince = time.Time{}
+		return false
+	}
+	if s.idleSince.IsZero() {
+		s.idleSince = now
+		return false
+	}
+	if now.Sub(s.idleSince) >= s.downDelay && p.maxCount > s.min {
+		p.maxCount--
+		s.idleSince = now
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package concpool
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAutoScaling(t *testing.T) {
+	p := NewAutoScaling(1, 4, WithCheckInterval(2*time.Millisecond), WithScaleDownDelay(5*time.Millisecond))
+	release := p.Hold()
+	var finished atomic.Int32
+	for i := 0; i < 40; i++ {
+		p.Run(func() error { time.Sleep(5 * time.Millisecond); finished.Add(1); return nil })
+	}
+	done := make(chan []TaskResult)
+	go func() { done <- p.Wait() }()
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s; MaxConcurrency() = %d", what, p.MaxConcurrency())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitFor("the pool to scale up", func() bool { return p.MaxConcurrency() == 4 })
+	if s := p.Stats(); s.MaxConcurrency != 4 {
+		t.Errorf("Stats().MaxConcurrency = %d, want 4", s.MaxConcurrency)
+	}
+	waitFor("the batch to finish", func() bool { return finished.Load() == 40 })
+
+	// Hold keeps the pool working on its batch, now idle
+	waitFor("the pool to scale down", func() bool { return p.MaxConcurrency() == 1 })
+	release()
+	if results := <-done; len(results) != 40 {
+		t.Fatalf("got %d results, want 40", len(results))
+	}
+}
+
+func TestAutoScalingBounds(t *testing.T) {
+	tests := []struct {
+		min, max         int
+		wantMin, wantMax int
+	}{
+		{2, 8, 2, 8},
+		{0, 3, 1, 3},
+		{5, 2, 5, 5},
+	}
+	for _, tt := range tests {
+		p := NewAutoScaling(tt.min, tt.max)
+		if p.scaler.min != tt.wantMin || p.scaler.max != tt.wantMax || p.MaxConcurrency() != tt.wantMin {
+			t.Errorf("NewAutoScaling(%d, %d) scales %d..%d from %d, want %d..%d from %d",
+				tt.min, tt.max, p.scaler.min, p.scaler.max, p.MaxConcurrency(), tt.wantMin, tt.wantMax, tt.wantMin)
+		}
+	}
+}
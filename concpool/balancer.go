@@ -0,0 +1,71 @@
+package concpool
+
+import "sync"
+
+// LoadBalancer spreads tasks over several pools, for example one per CPU
+// socket or one per downstream replica. Each task goes to the least loaded
+// pool at the time it is submitted: the one with the fewest queued and
+// running tasks relative to its concurrency limit, so pools receive work
+// roughly in proportion to their size.
+type LoadBalancer struct {
+	pools []*Pool
+
+	// mu serializes routing, so concurrent Run calls see each other's
+	// tasks when comparing loads.
+	mu sync.Mutex
+}
+
+// NewLoadBalancer creates a LoadBalancer over pools. It takes over
+// submitting to and waiting on them; they should not be used directly
+// while it is in use. It panics if no pools are given.
+func NewLoadBalancer(pools ...*Pool) *LoadBalancer {
+	if len(pools) == 0 {
+		panic("concpool: NewLoadBalancer needs at least one pool")
+	}
+	return &LoadBalancer{pools: pools}
+}
+
+// Run submits task to the least loaded pool.
+func (lb *LoadBalancer) Run(task func() error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	best, bestLoad := lb.pools[0], -1.0
+	for _, p := range lb.pools {
+		s := p.Stats()
+		load := float64(s.CurrentPending+s.CurrentRunning) / float64(s.MaxConcurrency)
+		if bestLoad < 0 || load < bestLoad {
+			best, bestLoad = p, load
+		}
+	}
+	best.Run(task)
+}
+
+// Wait blocks until every pool has finished its tasks and returns all the
+// results, grouped by pool in the order the pools were given. IDs are
+// assigned per pool, so they are only unique within one pool's results.
+func (lb *LoadBalancer) Wait() []TaskResult {
+	return waitAll(lb.pools)
+}
+
+// Stats returns the pools' statistics added together. Terminated is set
+// only if every pool has terminated; Name and CircuitState are left empty.
+func (lb *LoadBalancer) Stats() PoolStats {
+	total := PoolStats{Terminated: true}
+	for _, p := range lb.pools {
+		s := p.Stats()
+		total.Submitted += s.Submitted
+		total.Started += s.Started
+		total.Completed += s.Completed
+		total.Failed += s.Failed
+		total.Cancelled += s.Cancelled
+		total.CurrentRunning += s.CurrentRunning
+		total.CurrentPending += s.CurrentPending
+		total.MaxConcurrency += s.MaxConcurrency
+		total.FailureCount += s.FailureCount
+		total.CurrentTokens += s.CurrentTokens
+		total.Terminated = total.Terminated && s.Terminated
+		total.Goroutines += s.Goroutines
+	}
+	return total
+}
@@ -0,0 +1,40 @@
+package concpool
+
+import "testing"
+
+func TestLoadBalancer(t *testing.T) {
+	sizes := []int{1, 3, 6}
+	pools := make([]*Pool, len(sizes))
+	for i, n := range sizes {
+		pools[i] = NewSimple(n)
+	}
+	lb := NewLoadBalancer(pools...)
+	for i := 0; i < 1000; i++ {
+		lb.Run(func() error { return nil })
+	}
+
+	// nothing starts before Wait, so each pool still holds all it was given
+	for i, p := range pools {
+		want := 1000 * sizes[i] / 10
+		if got := p.Pending(); got < want-10 || got > want+10 {
+			t.Errorf("pool of %d got %d tasks, want about %d", sizes[i], got, want)
+		}
+	}
+	results := lb.Wait()
+	if len(results) != 1000 || HasErrors(results) {
+		t.Fatalf("Wait() = %d results, want 1000 successes", len(results))
+	}
+	s := lb.Stats()
+	if s.Submitted != 1000 || s.Completed != 1000 || s.MaxConcurrency != 10 || !s.Terminated {
+		t.Errorf("Stats() = %+v, want the three pools' totals", s)
+	}
+}
+
+func TestNewLoadBalancerNoPools(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("NewLoadBalancer() with no pools did not panic")
+		}
+	}()
+	NewLoadBalancer()
+}
@@ -0,0 +1,46 @@
+package concpool
+
+// ChainedPool is a two-stage pipeline created by Pool.Chain.
+type ChainedPool struct {
+	first, next *Pool
+	fn          func(TaskResult) (func() error, bool)
+}
+
+// Chain pipes the results of p into next: fn is called with each result of
+// p and returns a task to run on next, or false to skip that result. Nothing
+// happens until Wait is called on the returned ChainedPool, which runs both
+// stages at once, so next starts on the first results while p is still
+// working. p and next should not be waited on directly.
+func (p *Pool) Chain(next *Pool, fn func(TaskResult) (func() error, bool)) *ChainedPool {
+	return &ChainedPool{first: p, next: next, fn: fn}
+}
+
+// Wait runs both stages until they have finished and returns the results
+// of the second one. The results of the first stage are only seen by the
+// function given to Chain, which is called from a single goroutine.
+func (c *ChainedPool) Wait() []TaskResult {
+	next := c.next
+	next.lazyInit()
+
+	// like RunFromChannel, keep the second stage from terminating while
+	// the first can still feed it
+	next.mu.Lock()
+	next.feeders++
+	next.mu.Unlock()
+
+	next.spawn(func() {
+		defer func() {
+			next.mu.Lock()
+			next.feeders--
+			next.mu.Unlock()
+			next.attemptCheck()
+		}()
+
+		c.first.ForEachResult(func(r TaskResult) {
+			if task, ok := c.fn(r); ok {
+				next.Run(task)
+			}
+		})
+	})
+	return next.Wait()
+}
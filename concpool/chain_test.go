@@ -0,0 +1,50 @@
+package concpool
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	first, second := NewSimple(3), NewSimple(2)
+	const n = 20
+	generated := make([]string, n)
+	for i := range n {
+		first.Run(func() error {
+			if i == 7 {
+				return errors.New("generator failed")
+			}
+			generated[i] = fmt.Sprintf("word-%d", i)
+			return nil
+		})
+	}
+	upper := make([]string, n)
+	pipeline := first.Chain(second, func(r TaskResult) (func() error, bool) {
+		// failed results and every fifth word are skipped
+		if !r.Success || r.Index%5 == 0 {
+			return nil, false
+		}
+		return func() error {
+			upper[r.Index] = strings.ToUpper(generated[r.Index])
+			return nil
+		}, true
+	})
+	results := pipeline.Wait()
+
+	if len(results) != n-5 {
+		t.Fatalf("Wait() = %d results, want %d", len(results), n-5)
+	}
+	var want []string
+	for i := range n {
+		if i != 7 && i%5 != 0 {
+			want = append(want, fmt.Sprintf("WORD-%d", i))
+		}
+	}
+	got := slices.DeleteFunc(upper, func(s string) bool { return s == "" })
+	if !slices.Equal(got, want) {
+		t.Errorf("second stage produced %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,141 @@
+package concpool
+
+import "time"
+
+// Circuit breaker states, as reported in PoolStats.CircuitState.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+const defaultCircuitCooldown = 5 * time.Second
+
+// circuitBreaker stops a pool from starting tasks while too many of the
+// recent ones failed. All fields are guarded by the pool's mutex.
+type circuitBreaker struct {
+	threshold float64
+	cooldown  time.Duration
+
+	state string
+	// outcomes is a ring of the last results seen while closed, true for
+	// a failure; next is where the following one goes and filled reports
+	// whether the ring has wrapped.
+	outcomes []bool
+	next     int
+	filled   bool
+	// probing is set while the single half-open trial task runs.
+	probing bool
+}
+
+// WithCircuitBreaker makes the pool stop starting tasks when too many
+// recent ones failed. Once more than threshold (0.0 to 1.0) of the last
+// window results are failures, the circuit opens: new tasks are still
+// accepted but stay queued. After a cooldown (see
+// WithCircuitBreakerCooldown) the circuit is half-open and one queued task
+// is started as a trial; if it succeeds the circuit closes and the pool
+// carries on, otherwise it opens for another cooldown. The state is
+// reported in Stats as CircuitState.
+func WithCircuitBreaker(threshold float64, window int) Option {
+	return func(p *Pool) {
+		if window < 1 {
+			window = 1
+		}
+		p.breaker = &circuitBreaker{
+			threshold: threshold,
+			cooldown:  defaultCircuitCooldown,
+			state:     CircuitClosed,
+			outcomes:  make([]bool, window),
+		}
+	}
+}
+
+// WithCircuitBreakerCooldown sets how long the circuit set up by
+// WithCircuitBreaker stays open before a trial task is started. The
+// default is five seconds.
+func WithCircuitBreakerCooldown(d time.Duration) Option {
+	return func(p *Pool) {
+		if d > 0 {
+			p.circuitCooldown = d
+		}
+	}
+}
+
+// blocked reports whether the circuit holds back further tasks. The caller
+// must hold p.mu.
+func (b *circuitBreaker) blocked() bool {
+	return b.state == CircuitOpen || b.state == CircuitHalfOpen && b.probing
+}
+
+// admit is called for each task that starts, and makes it the trial task
+// if the circuit is half-open. The caller must hold p.mu.
+func (b *circuitBreaker) admit(t *job) {
+	if b.state == CircuitHalfOpen {
+		b.probing = true
+		t.probe = true
+	}
+}
+
+// record takes the outcome of t into account and reports whether the
+// circuit just opened. The caller must hold p.mu.
+func (b *circuitBreaker) record(t *job, failed bool) bool {
+	if t.probe {
+		b.probing = false
+		if failed {
+			b.state = CircuitOpen
+			return true
+		}
+		b.state = CircuitClosed
+		b.next, b.filled = 0, false
+		return false
+	}
+	if b.state != CircuitClosed {
+		return false
+	}
+
+	b.outcomes[b.next] = failed
+	b.next++
+	if b.next == len(b.outcomes) {
+		b.next, b.filled = 0, true
+	}
+	if !b.filled {
+		return false
+	}
+
+	failures := 0
+	for _, f := range b.outcomes {
+		if f {
+			failures++
+		}
+	}
+	if float64(failures)/float64(len(b.outcomes)) > b.threshold {
+		b.state = CircuitOpen
+		return true
+	}
+	return false
+}
+
+// recordOutcome updates the circuit breaker, if any, with the outcome of
+// t, and schedules the half-open trial if the circuit opened.
+func (p *Pool) recordOutcome(t *job, failed bool) {
+	if p.breaker == nil {
+		return
+	}
+
+	p.mu.Lock()
+	opened := p.breaker.record(t, failed)
+	p.mu.Unlock()
+
+	if opened {
+		time.AfterFunc(p.breaker.cooldown, func() {
+			p.mu.Lock()
+			if p.breaker.state == CircuitOpen {
+				p.breaker.state = CircuitHalfOpen
+			}
+			p.mu.Unlock()
+
+			p.checkQueue()
+			p.attemptCheck()
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package concpool
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	errDown := errors.New("downstream unavailable")
+	p := New(WithMaxConcurrency(1), WithCircuitBreaker(0.5, 4), WithCircuitBreakerCooldown(20*time.Millisecond))
+	var calls atomic.Int32
+	var mu sync.Mutex
+	var seen []string // the circuit state each task ran in
+	for i := 0; i < 10; i++ {
+		p.Run(func() error {
+			mu.Lock()
+			seen = append(seen, p.Stats().CircuitState)
+			mu.Unlock()
+			// the downstream recovers after five calls
+			if calls.Add(1) <= 5 {
+				return errDown
+			}
+			return nil
+		})
+	}
+	done := make(chan []TaskResult)
+	go func() { done <- p.Wait() }()
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s; state %q after %d calls", what, p.Stats().CircuitState, calls.Load())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// four failures in a window of four open the circuit
+	waitFor("the circuit to open", func() bool { return p.Stats().CircuitState == CircuitOpen })
+	if n := calls.Load(); n != 4 || p.Pending() != 6 {
+		t.Fatalf("circuit opened after %d calls with %d pending, want 4 and 6", n, p.Pending())
+	}
+
+	// after the cooldown the first trial fails and reopens the circuit, and
+	// the second succeeds and closes it
+	results := <-done
+	if len(results) != 10 || calls.Load() != 10 {
+		t.Fatalf("got %d results from %d calls, want 10", len(results), calls.Load())
+	}
+	if s := p.Stats().CircuitState; s != CircuitClosed {
+		t.Fatalf("CircuitState = %q at the end, want %q", s, CircuitClosed)
+	}
+	want := []string{
+		CircuitClosed, CircuitClosed, CircuitClosed, CircuitClosed,
+		CircuitHalfOpen, CircuitHalfOpen,
+		CircuitClosed, CircuitClosed, CircuitClosed, CircuitClosed,
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(seen, want) {
+		t.Fatalf("tasks ran in states %v, want %v", seen, want)
+	}
+}
+
+func TestCircuitBreakerStaysClosed(t *testing.T) {
+	p := New(WithMaxConcurrency(1), WithCircuitBreaker(0.5, 4))
+	for i := 0; i < 20; i++ {
+		// every other task fails, which is not more than half
+		p.Run(func() error {
+			if i%2 == 0 {
+				return errors.New("failed")
+			}
+			return nil
+		})
+	}
+	if results := p.Wait(); len(results) != 20 {
+		t.Fatalf("got %d results, want 20", len(results))
+	}
+	if s := p.Stats().CircuitState; s != CircuitClosed {
+		t.Fatalf("CircuitState = %q, want %q", s, CircuitClosed)
+	}
+	if s := NewSimple(1).Stats().CircuitState; s != "" {
+		t.Fatalf("CircuitState = %q without a circuit breaker, want empty", s)
+	}
+}
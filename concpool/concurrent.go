@@ -0,0 +1,51 @@
+package concpool
+
+import (
+	"slices"
+	"sync"
+)
+
+// ConcurrentGroup runs separate sets of tasks on separate pools at the same
+// time, each under its own pool's limits: say, at most 3 database writes
+// and at most 10 API calls at once. Unlike LoadBalancer, which decides
+// where each task goes, every task set here is tied to the pool it was
+// added with.
+type ConcurrentGroup struct {
+	mu    sync.Mutex
+	pools []*Pool
+}
+
+// NewConcurrentGroup creates an empty ConcurrentGroup.
+func NewConcurrentGroup() *ConcurrentGroup {
+	return &ConcurrentGroup{}
+}
+
+// Add submits tasks to pool, as Run would, and returns g so calls can be
+// chained. A pool may be added more than once; its task sets are merged.
+// The tasks start once Wait is called.
+func (g *ConcurrentGroup) Add(pool *Pool, tasks []func() error) *ConcurrentGroup {
+	g.mu.Lock()
+	if !slices.Contains(g.pools, pool) {
+		g.pools = append(g.pools, pool)
+	}
+	g.mu.Unlock()
+
+	for _, task := range tasks {
+		pool.Run(task)
+	}
+	return g
+}
+
+// Wait runs every pool in the group at once, blocks until all of them have
+// finished, and returns each pool's results keyed by the pool.
+func (g *ConcurrentGroup) Wait() map[*Pool][]TaskResult {
+	g.mu.Lock()
+	pools := slices.Clone(g.pools)
+	g.mu.Unlock()
+
+	results := make(map[*Pool][]TaskResult, len(pools))
+	for i, r := range waitEach(pools) {
+		results[pools[i]] = r
+	}
+	return results
+}
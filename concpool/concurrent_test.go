@@ -0,0 +1,56 @@
+package concpool
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConcurrentGroup(t *testing.T) {
+	type stage struct {
+		pool          *Pool
+		limit, tasks  int
+		running, peak atomic.Int32
+	}
+	stages := []*stage{
+		{pool: NewSimple(5), limit: 5, tasks: 100},
+		{pool: NewSimple(2), limit: 2, tasks: 50},
+	}
+	// set once a task of one pool sees the other pool busy
+	var overlapped atomic.Bool
+	g := NewConcurrentGroup()
+	for i, s := range stages {
+		other := stages[1-i]
+		tasks := make([]func() error, s.tasks)
+		for j := range tasks {
+			tasks[j] = func() error {
+				n := s.running.Add(1)
+				defer s.running.Add(-1)
+				for old := s.peak.Load(); n > old && !s.peak.CompareAndSwap(old, n); old = s.peak.Load() {
+				}
+				if other.running.Load() > 0 {
+					overlapped.Store(true)
+				}
+				time.Sleep(time.Millisecond)
+				return nil
+			}
+		}
+		g.Add(s.pool, tasks)
+	}
+	results := g.Wait()
+
+	if len(results) != len(stages) {
+		t.Fatalf("Wait() = results for %d pools, want %d", len(results), len(stages))
+	}
+	for _, s := range stages {
+		if got := len(results[s.pool]); got != s.tasks || HasErrors(results[s.pool]) {
+			t.Errorf("pool of %d: got %d results, want %d successes", s.limit, got, s.tasks)
+		}
+		if peak := s.peak.Load(); peak > int32(s.limit) {
+			t.Errorf("pool of %d ran %d tasks at once", s.limit, peak)
+		}
+	}
+	if !overlapped.Load() {
+		t.Error("the pools did not run at the same time")
+	}
+}
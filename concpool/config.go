@@ -0,0 +1,92 @@
+package concpool
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// PoolConfig is a declarative form of the most common Options, for pools
+// configured from a file or flags. It has JSON and YAML tags; RetryDelay is
+// a time.Duration, so in JSON it is a number of nanoseconds. Pass it to
+// NewFromConfig.
+type PoolConfig struct {
+	// MaxConcurrency is how many tasks may run at once, as set by
+	// WithMaxConcurrency. It must be positive.
+	MaxConcurrency int `json:"max_concurrency" yaml:"max_concurrency"`
+	// MaxQueue bounds the queue as WithMaxQueue does; zero means
+	// unbounded.
+	MaxQueue int `json:"max_queue" yaml:"max_queue"`
+	// MaxFailures cancels the pool after that many failures, as
+	// WithMaxFailures does; zero means no limit.
+	MaxFailures int `json:"max_failures" yaml:"max_failures"`
+	// RetryCount is how many times a failing task is retried after its
+	// first run, RetryDelay apart. Zero means no retries, and a zero
+	// RetryDelay means the default pause used by WithRetry.
+	RetryCount int           `json:"retry_count" yaml:"retry_count"`
+	RetryDelay time.Duration `json:"retry_delay" yaml:"retry_delay"`
+	// DisablePanicRecovery lets task panics crash the program, as
+	// WithoutPanicRecovery does. It is a negative so that a config
+	// that leaves it out keeps panic recovery on, as New does.
+	DisablePanicRecovery bool `json:"disable_panic_recovery" yaml:"disable_panic_recovery"`
+	// Name is the pool's name, as set by WithName.
+	Name string `json:"name" yaml:"name"`
+}
+
+// DefaultPoolConfig returns the config NewDefault corresponds to: one task
+// per CPU at a time, an unbounded queue, no failure limit or retries, and
+// panic recovery on.
+func DefaultPoolConfig() PoolConfig {
+	return PoolConfig{MaxConcurrency: runtime.GOMAXPROCS(0)}
+}
+
+// Validate reports the first setting in c that is out of range, or nil if
+// there is none.
+func (c PoolConfig) Validate() error {
+	switch {
+	case c.MaxConcurrency <= 0:
+		return fmt.Errorf("concpool: invalid config: MaxConcurrency must be positive, got %d", c.MaxConcurrency)
+	case c.MaxQueue < 0:
+		return fmt.Errorf("concpool: invalid config: MaxQueue must not be negative, got %d", c.MaxQueue)
+	case c.MaxFailures < 0:
+		return fmt.Errorf("concpool: invalid config: MaxFailures must not be negative, got %d", c.MaxFailures)
+	case c.RetryCount < 0:
+		return fmt.Errorf("concpool: invalid config: RetryCount must not be negative, got %d", c.RetryCount)
+	case c.RetryDelay < 0:
+		return fmt.Errorf("concpool: invalid config: RetryDelay must not be negative, got %v", c.RetryDelay)
+	}
+	return nil
+}
+
+// options returns the Options equivalent to c.
+func (c PoolConfig) options() []Option {
+	opts := []Option{
+		WithMaxConcurrency(c.MaxConcurrency),
+		WithMaxQueue(c.MaxQueue),
+		WithMaxFailures(c.MaxFailures),
+	}
+	if c.DisablePanicRecovery {
+		opts = append(opts, WithoutPanicRecovery())
+	}
+	if c.RetryCount > 0 {
+		delay := c.RetryDelay
+		if delay == 0 {
+			delay = defaultRetryDelay
+		}
+		retry := &RetryOptions{MaxAttempts: c.RetryCount + 1, InitialDelay: delay}
+		opts = append(opts, func(p *Pool) { p.retry = retry })
+	}
+	if c.Name != "" {
+		opts = append(opts, WithName(c.Name))
+	}
+	return opts
+}
+
+// NewFromConfig creates a Pool configured by cfg, or returns an error
+// describing the first invalid setting, as reported by Validate.
+func NewFromConfig(cfg PoolConfig) (*Pool, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return New(cfg.options()...), nil
+}
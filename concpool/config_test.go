@@ -0,0 +1,90 @@
+package concpool
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPoolConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     PoolConfig
+		wantErr string
+	}{
+		{"default", DefaultPoolConfig(), ""},
+		{"minimal", PoolConfig{MaxConcurrency: 2}, ""},
+		{"zero concurrency", PoolConfig{}, "MaxConcurrency"},
+		{"negative queue", PoolConfig{MaxConcurrency: 1, MaxQueue: -1}, "MaxQueue"},
+		{"negative failures", PoolConfig{MaxConcurrency: 1, MaxFailures: -1}, "MaxFailures"},
+		{"negative retries", PoolConfig{MaxConcurrency: 1, RetryCount: -1}, "RetryCount"},
+		{"negative delay", PoolConfig{MaxConcurrency: 1, RetryDelay: -time.Second}, "RetryDelay"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewFromConfig(tt.cfg)
+			if tt.wantErr == "" {
+				if err != nil || p == nil {
+					t.Fatalf("NewFromConfig() = %v, %v; want a pool", p, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("NewFromConfig() error = %v, want one mentioning %s", err, tt.wantErr)
+			}
+			if p != nil {
+				t.Fatal("NewFromConfig() returned a pool for an invalid config")
+			}
+			if verr := tt.cfg.Validate(); verr == nil || verr.Error() != err.Error() {
+				t.Fatalf("Validate() = %v, want %v", verr, err)
+			}
+		})
+	}
+}
+
+func TestPoolConfigFromJSON(t *testing.T) {
+	var cfg PoolConfig
+	in := `{"max_concurrency": 3, "max_queue": 10, "retry_count": 2, "name": "import"}`
+	if err := json.Unmarshal([]byte(in), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.MaxConcurrency() != 3 || p.Name() != "import" {
+		t.Fatalf("pool has concurrency %d and name %q", p.MaxConcurrency(), p.Name())
+	}
+
+	// leaving panic recovery out of the file must keep it on
+	p.Run(func() error { panic("boom") })
+	var attempts int
+	p.Run(func() error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("flaky")
+		}
+		return nil
+	})
+	for _, r := range p.Wait() {
+		var pe *PanicError
+		switch {
+		case r.Index == 0 && !errors.As(r.Err, &pe):
+			t.Errorf("panicking task: Err = %v, want a *PanicError", r.Err)
+		case r.Index == 1 && (!r.Success || r.Attempts != 3):
+			t.Errorf("flaky task: Success = %v after %d attempts, want success after 3", r.Success, r.Attempts)
+		}
+	}
+}
+
+func TestPoolConfigDisablePanicRecovery(t *testing.T) {
+	p, err := NewFromConfig(PoolConfig{MaxConcurrency: 1, DisablePanicRecovery: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.recoverPanics {
+		t.Fatal("DisablePanicRecovery left panic recovery on")
+	}
+}
@@ -0,0 +1,65 @@
+package concpool
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// DurationOverflow is the DurationHistogram bucket counting the tasks that
+// took longer than the largest bound asked for.
+const DurationOverflow = time.Duration(math.MaxInt64)
+
+// DurationHistogram returns how many of the tasks in results fell into
+// each of buckets, keyed by the bucket's upper bound: a task counts towards
+// the smallest bound at least as long as its Duration. Tasks slower than
+// every bound are counted under DurationOverflow, which is present only if
+// there are any. Tasks that never ran, such as cancelled ones, are not
+// counted.
+func DurationHistogram(results []TaskResult, buckets []time.Duration) map[time.Duration]int {
+	bounds := slices.Clone(buckets)
+	slices.Sort(bounds)
+	bounds = slices.Compact(bounds)
+
+	hist := make(map[time.Duration]int, len(bounds)+1)
+	for _, b := range bounds {
+		hist[b] = 0
+	}
+	for _, d := range ranDurations(results) {
+		i, _ := slices.BinarySearch(bounds, d)
+		if i == len(bounds) {
+			hist[DurationOverflow]++
+		} else {
+			hist[bounds[i]]++
+		}
+	}
+	return hist
+}
+
+// Percentile returns the pct-th percentile, for pct between 0 and 100, of
+// the durations of the tasks in results that ran, using the nearest-rank
+// method: Percentile(results, 50) is the median and Percentile(results,
+// 100) the slowest task. pct is clamped to that range, and the result is
+// zero if no task ran.
+func Percentile(results []TaskResult, pct float64) time.Duration {
+	durations := ranDurations(results)
+	if len(durations) == 0 {
+		return 0
+	}
+	slices.Sort(durations)
+
+	pct = math.Max(0, math.Min(100, pct))
+	rank := int(math.Ceil(pct / 100 * float64(len(durations))))
+	return durations[max(rank, 1)-1]
+}
+
+// ranDurations returns the Durations of the results whose task ran.
+func ranDurations(results []TaskResult) []time.Duration {
+	durations := make([]time.Duration, 0, len(results))
+	for _, r := range results {
+		if !r.StartedAt.IsZero() {
+			durations = append(durations, r.Duration)
+		}
+	}
+	return durations
+}
@@ -0,0 +1,103 @@
+package concpool
+
+import (
+	"testing"
+	"time"
+)
+
+// ranFor returns results of tasks that ran for each of ds.
+func ranFor(ds ...time.Duration) []TaskResult {
+	results := make([]TaskResult, len(ds))
+	for i, d := range ds {
+		results[i] = TaskResult{ID: uint64(i + 1), Success: true, StartedAt: time.Now(), Duration: d}
+	}
+	return results
+}
+
+func TestDurationHistogram(t *testing.T) {
+	ms := time.Millisecond
+	results := append(ranFor(1*ms, 5*ms, 10*ms, 11*ms, 100*ms, 2*time.Second),
+		TaskResult{Cancelled: true, Err: ErrCancelled})
+
+	tests := []struct {
+		name    string
+		buckets []time.Duration
+		want    map[time.Duration]int
+	}{
+		{"bounds inclusive", []time.Duration{5 * ms, 10 * ms, time.Second},
+			map[time.Duration]int{5 * ms: 2, 10 * ms: 1, time.Second: 2, DurationOverflow: 1}},
+		{"unsorted and repeated", []time.Duration{time.Hour, 10 * ms, 10 * ms},
+			map[time.Duration]int{10 * ms: 3, time.Hour: 3}},
+		{"empty buckets stay", []time.Duration{time.Microsecond, 3 * time.Second},
+			map[time.Duration]int{time.Microsecond: 0, 3 * time.Second: 6}},
+		{"no buckets", nil, map[time.Duration]int{DurationOverflow: 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DurationHistogram(results, tt.buckets)
+			if len(got) != len(tt.want) {
+				t.Fatalf("DurationHistogram() = %v, want %v", got, tt.want)
+			}
+			for b, n := range tt.want {
+				if got[b] != n {
+					t.Fatalf("DurationHistogram() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	ds := make([]time.Duration, 100)
+	for i := range ds {
+		ds[i] = time.Duration(i+1) * time.Millisecond
+	}
+	results := ranFor(ds...)
+
+	tests := []struct {
+		pct  float64
+		want time.Duration
+	}{
+		{0, 1 * time.Millisecond},
+		{1, 1 * time.Millisecond},
+		{50, 50 * time.Millisecond},
+		{99, 99 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+		{250, 100 * time.Millisecond},
+		{-5, 1 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := Percentile(results, tt.pct); got != tt.want {
+			t.Errorf("Percentile(%v) = %v, want %v", tt.pct, got, tt.want)
+		}
+	}
+	if got := Percentile([]TaskResult{{Cancelled: true}}, 50); got != 0 {
+		t.Errorf("Percentile of tasks that never ran = %v, want 0", got)
+	}
+}
+
+func TestPercentileOfSleeps(t *testing.T) {
+	const fast, slow = 20 * time.Millisecond, 100 * time.Millisecond
+	p := New(WithMaxConcurrency(50))
+	for i := 0; i < 100; i++ {
+		d := fast
+		if i%50 == 0 {
+			d = slow
+		}
+		p.Run(func() error {
+			time.Sleep(d)
+			return nil
+		})
+	}
+	results := p.Wait()
+
+	for _, c := range []struct {
+		pct  float64
+		want time.Duration
+	}{{50, fast}, {99, slow}} {
+		got := Percentile(results, c.pct)
+		if got < c.want || got > c.want+c.want/10 {
+			t.Errorf("Percentile(%v) = %v, want %v within 10%%", c.pct, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package concpool
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrCancelled is the error recorded for tasks that were dropped by
+// Pool.Cancel before they started.
+var ErrCancelled = errors.New("concpool: task cancelled")
+
+// ErrQueueFull is the error recorded for tasks that were rejected because
+// the pool's queue had reached the limit set by WithMaxQueue.
+var ErrQueueFull = errors.New("concpool: queue is full")
+
+// ErrTimeout is the error recorded for tasks submitted with RunWithTimeout
+// that did not finish in time.
+var ErrTimeout = errors.New("concpool: task timed out")
+
+// ErrTaskExpired is the error recorded for tasks submitted with RunWithTTL
+// that were not started before their TTL ran out.
+var ErrTaskExpired = errors.New("concpool: task expired before it started")
+
+// ErrSkipped is the error recorded for the tasks of a Pool.RunSerial chain
+// that were not run because an earlier task in it failed.
+var ErrSkipped = errors.New("concpool: task skipped after an earlier task failed")
+
+// ErrDependencyFailed is the error recorded for a Pool.RunAfterAll task
+// that was not run because one of the tasks it depends on was
+// unsuccessful.
+var ErrDependencyFailed = errors.New("concpool: task skipped after a dependency failed")
+
+// ErrPoolTerminated is returned by ErrGroup.Wait for functions passed to
+// ErrGroup.Go after the pool's Wait had returned, which were not run.
+var ErrPoolTerminated = errors.New("concpool: pool has already terminated")
+
+// ErrMaxFailuresExceeded is the error of the extra TaskResult a pool
+// reports when it cancels itself after the number of failures set by
+// WithMaxFailures.
+var ErrMaxFailuresExceeded = errors.New("concpool: too many tasks failed")
+
+// PanicError is the error recorded in a TaskResult when a task panics. It
+// carries the recovered value and the stack of the goroutine that panicked,
+// plus the task's name if it was submitted with RunNamed and the pool's
+// name if it was given one with WithName.
+type PanicError struct {
+	Pool  string
+	Name  string
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	var prefix string
+	if e.Pool != "" {
+		prefix = fmt.Sprintf("pool %q: ", e.Pool)
+	}
+	if e.Name != "" {
+		prefix += fmt.Sprintf("task %q: ", e.Name)
+	}
+	return fmt.Sprintf("%spanic: %v\n%s", prefix, e.Value, e.Stack)
+}
@@ -0,0 +1,166 @@
+package concpool
+
+import "sync"
+
+// Future is a handle to the result of a single task submitted with Submit.
+// It is safe to use from multiple goroutines.
+type Future struct {
+	done   chan struct{}
+	result TaskResult
+
+	// mu guards callbacks, the functions registered with onResolve.
+	mu        sync.Mutex
+	callbacks []func(TaskResult)
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+// resolve stores r and wakes everyone waiting on the future. It must be
+// called exactly once.
+func (f *Future) resolve(r TaskResult) {
+	f.mu.Lock()
+	f.result = r
+	close(f.done)
+	callbacks := f.callbacks
+	f.callbacks = nil
+	f.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(r)
+	}
+}
+
+// onResolve arranges for fn to be called with the task's result once it is
+// available, straight away if it already is. fn may be called with a
+// pool's lock held, so it must not block or submit tasks itself.
+func (f *Future) onResolve(fn func(TaskResult)) {
+	f.mu.Lock()
+	select {
+	case <-f.done:
+		f.mu.Unlock()
+		fn(f.result)
+		return
+	default:
+	}
+	f.callbacks = append(f.callbacks, fn)
+	f.mu.Unlock()
+}
+
+// Get blocks until the task has finished and returns its result.
+func (f *Future) Get() TaskResult {
+	<-f.done
+	return f.result
+}
+
+// Done returns a channel that is closed once the task's result is
+// available.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result returns the task's result and true if it has finished, or a zero
+// TaskResult and false if it hasn't yet. It never blocks.
+func (f *Future) Result() (TaskResult, bool) {
+	select {
+	case <-f.done:
+		return f.result, true
+	default:
+		return TaskResult{}, false
+	}
+}
+
+// Submit is like Run but returns a Future for the task, so its result can
+// be awaited on its own. The result is still included in what Wait
+// returns. Tasks only make progress while the pool is being waited on, so
+// call Wait (or Results) from some goroutine before blocking on Get.
+func (p *Pool) Submit(task func() error) *Future {
+	f := newFuture()
+	p.submit(&job{fn: task, future: f})
+	return f
+}
+
+// FanOut submits count copies of task, like RunN, and returns a Future for
+// each copy in submission order. The same caveat about shared closures
+// applies.
+func (p *Pool) FanOut(task func() error, count int) []*Future {
+	futures := make([]*Future, count)
+	for i := range futures {
+		futures[i] = p.Submit(task)
+	}
+	return futures
+}
+
+// RunAfterAll submits task once every Future in deps has resolved, and
+// returns a Future for it, so tasks can be arranged in a dependency graph:
+// a task with several dependents is awaited by each of them, and one with
+// several dependencies runs after the last. The deps may come from Submit,
+// FanOut or RunAfterAll itself, on p or on other pools. If any dep was
+// unsuccessful, task is not run; it is reported with Skipped and Cancelled
+// set and Err set to ErrDependencyFailed, which in turn skips its own
+// dependents. Since a Future only exists once its task has been submitted,
+// a task can't depend on itself or on its dependents, so the graph has no
+// cycles.
+//
+// Until task has been submitted or skipped the pool is held (see Hold), so
+// Wait does not return before it has run; deps on another pool must
+// therefore resolve without waiting on p. Like a RunSerial task, task is
+// given its ID when it is submitted. RunAfterAll panics if a dep is nil.
+func (p *Pool) RunAfterAll(deps []*Future, task func() error) *Future {
+	for _, dep := range deps {
+		if dep == nil {
+			panic("concpool: RunAfterAll with a nil dependency")
+		}
+	}
+
+	f := newFuture()
+	release := p.Hold()
+	start := func(failed bool) {
+		defer release()
+		if failed {
+			p.skipDependent(f)
+			return
+		}
+		t := &job{fn: task, future: f}
+		t.id = p.lastID.Add(1)
+		p.counts.submitted.Add(1)
+		p.pushToQueue(t)
+		p.attemptCheck()
+	}
+	if len(deps) == 0 {
+		start(false)
+		return f
+	}
+
+	var mu sync.Mutex
+	remaining, failed := len(deps), false
+	for _, dep := range deps {
+		dep.onResolve(func(r TaskResult) {
+			mu.Lock()
+			remaining--
+			failed = failed || !r.Success
+			last, skip := remaining == 0, failed
+			mu.Unlock()
+			// deps can resolve under a pool's lock, so submit from
+			// a goroutine of our own
+			if last {
+				p.spawn(func() { start(skip) })
+			}
+		})
+	}
+	return f
+}
+
+// skipDependent reports the RunAfterAll task behind f as skipped because a
+// dependency failed.
+func (p *Pool) skipDependent(f *Future) {
+	id := p.lastID.Add(1)
+	r := TaskResult{ID: id, Index: int(id - 1), Success: false, Err: ErrDependencyFailed, Cancelled: true, Skipped: true}
+	p.counts.submitted.Add(1)
+	p.counts.cancelled.Add(1)
+	p.mu.Lock()
+	p.dropped = append(p.dropped, r)
+	p.mu.Unlock()
+	f.resolve(r)
+}
@@ -0,0 +1,157 @@
+package concpool
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFutureGet(t *testing.T) {
+	errFailed := errors.New("failed")
+	p := NewSimple(2)
+	releaseA, releaseB := make(chan struct{}), make(chan struct{})
+	a := p.Submit(func() error { <-releaseA; return nil })
+	b := p.Submit(func() error { <-releaseB; return errFailed })
+	if _, ok := a.Result(); ok {
+		t.Fatal("Result() reported a result before the task ran")
+	}
+	go p.Wait()
+
+	got := make(chan TaskResult, 2)
+	go func() { got <- a.Get() }()
+	go func() { got <- b.Get() }()
+
+	close(releaseB)
+	select {
+	case r := <-got:
+		if r.Success || !errors.Is(r.Err, errFailed) {
+			t.Fatalf("b.Get() = %+v, want failure with %v", r, errFailed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("b.Get() did not return after its task finished")
+	}
+	select {
+	case r := <-got:
+		t.Fatalf("a.Get() returned %+v before its task finished", r)
+	case <-a.Done():
+		t.Fatal("a.Done() closed before its task finished")
+	default:
+	}
+
+	close(releaseA)
+	if r := <-got; !r.Success {
+		t.Fatalf("a.Get() = %+v, want success", r)
+	}
+	<-a.Done()
+	if r, ok := a.Result(); !ok || !r.Success {
+		t.Fatalf("a.Result() = %+v, %v; want success, true", r, ok)
+	}
+}
+
+func TestFutureCancelled(t *testing.T) {
+	p := NewSimple(1)
+	p.Run(func() error { p.Cancel(); return nil })
+	f := p.Submit(func() error { return nil })
+	p.Wait()
+	if r := f.Get(); !r.Cancelled {
+		t.Fatalf("Get() = %+v, want a cancelled result", r)
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	p := NewSimple(3)
+	var calls atomic.Int32
+	futures := p.FanOut(func() error {
+		if calls.Add(1) == 2 {
+			return errors.New("second call failed")
+		}
+		return nil
+	}, 5)
+	go p.Wait()
+
+	if len(futures) != 5 {
+		t.Fatalf("FanOut returned %d futures, want 5", len(futures))
+	}
+	failed := 0
+	for i, f := range futures {
+		r := f.Get()
+		if r.ID != uint64(i+1) {
+			t.Errorf("futures[%d] resolved with task %d", i, r.ID)
+		}
+		if !r.Success {
+			failed++
+		}
+	}
+	if calls.Load() != 5 || failed != 1 {
+		t.Fatalf("%d calls with %d failures, want 5 with 1", calls.Load(), failed)
+	}
+}
+
+func TestRunAfterAllDiamond(t *testing.T) {
+	p := NewSimple(4)
+	var mu sync.Mutex
+	started := make(map[string]time.Time)
+	finished := make(map[string]time.Time)
+	step := func(name string, d time.Duration) func() error {
+		return func() error {
+			mu.Lock()
+			started[name] = time.Now()
+			mu.Unlock()
+			time.Sleep(d)
+			mu.Lock()
+			finished[name] = time.Now()
+			mu.Unlock()
+			return nil
+		}
+	}
+	a := p.Submit(step("A", 5*time.Millisecond))
+	b := p.RunAfterAll([]*Future{a}, step("B", 20*time.Millisecond))
+	c := p.RunAfterAll([]*Future{a}, step("C", 5*time.Millisecond))
+	d := p.RunAfterAll([]*Future{b, c}, step("D", 0))
+	results := p.Wait()
+
+	if len(results) != 4 || HasErrors(results) || !d.Get().Success {
+		t.Fatalf("Wait() = %+v, want four successes", results)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, edge := range [][2]string{{"A", "B"}, {"A", "C"}, {"B", "D"}, {"C", "D"}} {
+		if started[edge[1]].Before(finished[edge[0]]) {
+			t.Errorf("%s started before %s finished", edge[1], edge[0])
+		}
+	}
+}
+
+func TestRunAfterAllFailedDependency(t *testing.T) {
+	p := NewSimple(2)
+	failed := p.Submit(func() error { return errors.New("failed") })
+	skipped := p.RunAfterAll([]*Future{failed}, func() error { t.Error("task with a failed dependency ran"); return nil })
+	// skipping cascades to the skipped task's dependents
+	cascaded := p.RunAfterAll([]*Future{skipped, p.Submit(func() error { return nil })}, func() error {
+		t.Error("dependent of a skipped task ran")
+		return nil
+	})
+	independent := p.RunAfterAll(nil, func() error { return nil })
+	results := p.Wait()
+
+	if len(results) != 5 {
+		t.Fatalf("Wait() = %d results, want 5", len(results))
+	}
+	for name, f := range map[string]*Future{"skipped": skipped, "cascaded": cascaded} {
+		if r := f.Get(); !r.Skipped || !errors.Is(r.Err, ErrDependencyFailed) {
+			t.Errorf("%s task: got %+v, want Skipped with ErrDependencyFailed", name, r)
+		}
+	}
+	if r := independent.Get(); !r.Success {
+		t.Errorf("task without dependencies: got %+v, want a success", r)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("RunAfterAll with a nil dependency did not panic")
+		}
+	}()
+	p.RunAfterAll([]*Future{nil}, func() error { return nil })
+}
@@ -0,0 +1,362 @@
+package concpool
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// TaskGroup is a set of tasks on a shared Pool that can be waited on by
+// itself, so several producers can use one pool without collecting each
+// other's results. Use Pool.Group to create one.
+//
+// Results of group tasks are reported to the group only: they don't appear
+// in Pool.Wait, Pool.Results or Pool.Shutdown, although they do count in
+// Stats and are passed to the OnComplete and OnError callbacks.
+type TaskGroup struct {
+	pool *Pool
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending int
+	results []TaskResult
+
+	// onResult, if set, is called with every result before it is added,
+	// including those of tasks dropped before they ran.
+	onResult func(TaskResult)
+}
+
+// Group returns a new, empty TaskGroup that runs its tasks on p.
+func (p *Pool) Group() *TaskGroup {
+	g := &TaskGroup{pool: p}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// RunBatch submits tasks and waits for exactly those to finish, like a
+// Wait scoped to them: tasks other goroutines submit to p meanwhile don't
+// hold it up, and their results are not included. The results are in the
+// order of tasks. It runs the batch as a TaskGroup, so the results are not
+// reported to Pool.Wait either.
+func (p *Pool) RunBatch(tasks []func() error) []TaskResult {
+	g := p.Group()
+	for _, task := range tasks {
+		g.Run(task)
+	}
+	results := g.Wait()
+	slices.SortFunc(results, func(a, b TaskResult) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return results
+}
+
+// RunConcurrent is like RunBatch, for the common case of doing a few
+// things in parallel, but is also safe to call from a task of p. Rather
+// than only blocking, the calling goroutine runs the tasks of the batch
+// that no worker has started yet, last first, so the batch finishes even
+// when every slot is held by tasks waiting in RunConcurrent themselves.
+// Tasks run that way go through the pool's middleware, retries and panic
+// recovery like any other, but not its rate limiter or circuit breaker,
+// and each caller may take the pool one task over its concurrency limit.
+func (p *Pool) RunConcurrent(tasks ...func() error) []TaskResult {
+	g := p.Group()
+	jobs := make([]*job, len(tasks))
+	for i, task := range tasks {
+		jobs[i] = &job{fn: task, shared: true}
+		g.submit(jobs[i])
+	}
+	p.checkQueue()
+	for i := len(jobs) - 1; i >= 0; i-- {
+		p.help(jobs[i])
+	}
+
+	results := g.Wait()
+	slices.SortFunc(results, func(a, b TaskResult) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return results
+}
+
+// Par2 runs a and b with RunConcurrent and returns their results in that
+// order.
+func (p *Pool) Par2(a, b func() error) (TaskResult, TaskResult) {
+	results := p.RunConcurrent(a, b)
+	return results[0], results[1]
+}
+
+// help runs t on the calling goroutine, counted as running like any
+// other task, unless a worker has already taken it. A job submitted after
+// Cancel is dropped instead, as a worker would.
+func (p *Pool) help(t *job) {
+	p.mu.Lock()
+	if p.cancelled && !t.deferred {
+		p.drop(t, ErrCancelled)
+		p.mu.Unlock()
+		return
+	}
+	if !t.take() {
+		p.mu.Unlock()
+		return
+	}
+	p.running += t.cost()
+	p.inflight[t.id] = t
+	p.counts.started.Add(1)
+	p.mu.Unlock()
+
+	p.execute(t)
+
+	p.mu.Lock()
+	p.finish(t)
+	p.mu.Unlock()
+	p.attemptCheck()
+}
+
+// Run submits a task to the group's pool and returns its ID. The task
+// shares the pool's queue and concurrency limit with every other task, but
+// starts without the pool having to be waited on.
+func (g *TaskGroup) Run(task func() error) uint64 {
+	id := g.submit(&job{fn: task})
+	g.pool.checkQueue()
+	return id
+}
+
+// runLive is like Run, but submits nothing and returns false if the
+// pool's Wait has already returned, in which case task would not run
+// until the pool is Reset.
+func (g *TaskGroup) runLive(task func() error) bool {
+	p := g.pool
+	p.lazyInit()
+	p.mu.Lock()
+	if p.terminated {
+		p.mu.Unlock()
+		return false
+	}
+	// hold the pool, as Hold does, so it can't terminate before the task
+	// is queued
+	p.feeders++
+	p.mu.Unlock()
+
+	g.Run(task)
+
+	p.mu.Lock()
+	p.feeders--
+	p.mu.Unlock()
+	p.attemptCheck()
+	return true
+}
+
+// submit adds t to the group and submits it to the group's pool, without
+// starting it.
+func (g *TaskGroup) submit(t *job) uint64 {
+	g.mu.Lock()
+	g.pending++
+	g.mu.Unlock()
+
+	t.group = g
+	return g.pool.submit(t)
+}
+
+// Wait blocks until every task submitted to the group has finished and
+// returns their results in the order they completed. Each call returns
+// only the results collected since the previous one, so a group can be
+// reused for another batch.
+//
+// Like any task, group tasks submitted to a pool whose Wait has already
+// returned don't run until the pool is Reset.
+func (g *TaskGroup) Wait() []TaskResult {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for g.pending > 0 {
+		g.cond.Wait()
+	}
+	results := g.results
+	g.results = nil
+	return results
+}
+
+// add records the result of one of the group's tasks.
+func (g *TaskGroup) add(r TaskResult) {
+	if g.onResult != nil {
+		g.onResult(r)
+	}
+	g.mu.Lock()
+	g.results = append(g.results, r)
+	g.pending--
+	if g.pending == 0 {
+		g.cond.Broadcast()
+	}
+	g.mu.Unlock()
+}
+
+// ErrGroup adapts a pool to the API of golang.org/x/sync/errgroup.Group,
+// so code written against errgroup can run its goroutines on a Pool by
+// swapping the type: Go, TryGo, SetLimit and Wait behave as they do there,
+// and Pool.ErrGroupWithContext stands in for errgroup.WithContext. Use
+// Pool.ErrGroup to create one. The zero value is a valid group with no
+// pool, which runs each function on a goroutine of its own, exactly like a
+// zero errgroup.Group.
+//
+// A function that panics counts as failed with the pool's *PanicError, and
+// one the pool drops without running it (after a WithFailFast failure, on
+// Cancel, or when a WithMaxQueue queue is full) with the error its result
+// records, so Wait returns instead of waiting for it.
+//
+// Functions passed to Go after the pool's Wait has returned are not run,
+// since the pool would hold them until Reset, and Wait returns
+// ErrPoolTerminated for them instead of blocking forever.
+type ErrGroup struct {
+	group  *TaskGroup
+	cancel func(error)
+
+	wg  sync.WaitGroup
+	sem chan struct{}
+
+	errOnce sync.Once
+	err     error
+
+	// dropErr is the error of the first function the pool dropped. It is
+	// only returned if no function failed, since a fail-fast pool drops
+	// functions before it reports the failure that made it stop.
+	dropOnce sync.Once
+	dropErr  error
+}
+
+// ErrGroup returns a new ErrGroup that runs its functions on p. It is built
+// on a TaskGroup, so the same rules apply.
+func (p *Pool) ErrGroup() *ErrGroup {
+	return newErrGroup(p, nil)
+}
+
+// ErrGroupWithContext is like ErrGroup, but also returns a context derived
+// from ctx, as errgroup.WithContext does. The context is cancelled the
+// first time a function passed to Go or TryGo returns an error, or the
+// first time Wait returns, whichever happens first.
+func (p *Pool) ErrGroupWithContext(ctx context.Context) (*ErrGroup, context.Context) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return newErrGroup(p, cancel), ctx
+}
+
+// newErrGroup creates an ErrGroup on p whose functions are accounted for
+// through their results, so functions the pool drops or that panic still
+// finish the group.
+func newErrGroup(p *Pool, cancel func(error)) *ErrGroup {
+	g := &ErrGroup{group: p.Group(), cancel: cancel}
+	g.group.onResult = g.settled
+	return g
+}
+
+// Go runs f on the pool, subject to its concurrency limit. If SetLimit has
+// set a limit for the group, Go blocks until f can run without exceeding
+// it.
+func (g *ErrGroup) Go(f func() error) {
+	if g.sem != nil {
+		g.sem <- struct{}{}
+	}
+	g.start(f)
+}
+
+// TryGo runs f on the pool only if that doesn't exceed the group's limit
+// (see SetLimit), and reports whether it did.
+func (g *ErrGroup) TryGo(f func() error) bool {
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		default:
+			return false
+		}
+	}
+	g.start(f)
+	return true
+}
+
+// SetLimit limits the number of functions of the group that may be active
+// at once to n, on top of the pool's own limit. A negative n removes the
+// limit. As with errgroup, the limit must not be changed while any
+// function of the group is active.
+func (g *ErrGroup) SetLimit(n int) {
+	if n < 0 {
+		g.sem = nil
+		return
+	}
+	if len(g.sem) != 0 {
+		panic(fmt.Errorf("concpool: modify limit while %d functions in the group are still active", len(g.sem)))
+	}
+	g.sem = make(chan struct{}, n)
+}
+
+// Wait blocks until every function passed to Go has returned, and then
+// returns the first error any of them returned, or nil.
+func (g *ErrGroup) Wait() error {
+	if g.group != nil {
+		g.group.Wait()
+	}
+	g.wg.Wait()
+	err := g.err
+	if err == nil {
+		err = g.dropErr
+	}
+	if g.cancel != nil {
+		g.cancel(err)
+	}
+	return err
+}
+
+// start runs f for Go and TryGo once its slot under the group's limit, if
+// any, has been taken.
+func (g *ErrGroup) start(f func() error) {
+	g.wg.Add(1)
+	if g.group == nil {
+		go func() {
+			defer g.done()
+			if err := f(); err != nil {
+				g.fail(err)
+			}
+		}()
+		return
+	}
+	// the function's result, rather than the function itself, finishes
+	// it, so that functions dropped by the pool (WithFailFast, Cancel, a
+	// full queue) or recovered from a panic are accounted for too
+	if !g.group.runLive(f) {
+		g.fail(ErrPoolTerminated)
+		g.done()
+	}
+}
+
+// settled records the result of one of the group's functions on a pool.
+func (g *ErrGroup) settled(r TaskResult) {
+	if !r.Success {
+		err := r.Err
+		if err == nil {
+			err = fmt.Errorf("concpool: task %d failed", r.ID)
+		}
+		if r.Cancelled {
+			g.dropOnce.Do(func() { g.dropErr = err })
+		} else {
+			g.fail(err)
+		}
+	}
+	g.done()
+}
+
+// done marks one of the group's functions as finished.
+func (g *ErrGroup) done() {
+	if g.sem != nil {
+		<-g.sem
+	}
+	g.wg.Done()
+}
+
+// fail records err unless an earlier function already failed, and cancels
+// the group's context.
+func (g *ErrGroup) fail(err error) {
+	g.errOnce.Do(func() {
+		g.err = err
+		if g.cancel != nil {
+			g.cancel(err)
+		}
+	})
+}
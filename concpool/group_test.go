@@ -0,0 +1,386 @@
+package concpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// errGroup is the subset of errgroup.Group the tests below are written
+// against, so the same code runs on a pool and on a zero ErrGroup.
+type errGroup interface {
+	Go(f func() error)
+	TryGo(f func() error) bool
+	SetLimit(n int)
+	Wait() error
+}
+
+// fetchAll is errgroup's JustErrors example, with the HTTP call faked.
+func fetchAll(g errGroup, urls []string, fetch func(string) error) error {
+	for _, url := range urls {
+		// Launch a goroutine to fetch the URL.
+		g.Go(func() error {
+			// Fetch the URL.
+			return fetch(url)
+		})
+	}
+	// Wait for all HTTP fetches to complete.
+	return g.Wait()
+}
+
+func TestErrGroupRunsErrgroupCode(t *testing.T) {
+	urls := []string{"http://www.golang.org/", "http://www.google.com/", "http://www.somestupidname.com/"}
+	errNoHost := errors.New("no such host")
+	fetch := func(url string) error {
+		time.Sleep(time.Millisecond)
+		if url == "http://www.somestupidname.com/" {
+			return errNoHost
+		}
+		return nil
+	}
+
+	groups := []struct {
+		name string
+		new  func() errGroup
+	}{
+		{"pool", func() errGroup { return New(WithMaxConcurrency(2)).ErrGroup() }},
+		{"zero value", func() errGroup { return new(ErrGroup) }},
+	}
+	for _, g := range groups {
+		t.Run(g.name, func(t *testing.T) {
+			if err := fetchAll(g.new(), urls, fetch); err != errNoHost {
+				t.Fatalf("Wait() = %v, want %v", err, errNoHost)
+			}
+			if err := fetchAll(g.new(), urls[:2], fetch); err != nil {
+				t.Fatalf("Wait() = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestErrGroupWithContext(t *testing.T) {
+	p := New(WithMaxConcurrency(4))
+	g, ctx := p.ErrGroupWithContext(context.Background())
+
+	errFirst := errors.New("first")
+	var sawCancel atomic.Bool
+	g.Go(func() error { return errFirst })
+	g.Go(func() error {
+		select {
+		case <-ctx.Done():
+			sawCancel.Store(true)
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+			return errors.New("context was not cancelled")
+		}
+	})
+	if err := g.Wait(); err != errFirst {
+		t.Fatalf("Wait() = %v, want %v", err, errFirst)
+	}
+	if !sawCancel.Load() {
+		t.Fatal("the second function did not see the context cancelled")
+	}
+	if cause := context.Cause(ctx); cause != errFirst {
+		t.Fatalf("context.Cause() = %v, want %v", cause, errFirst)
+	}
+
+	// a successful group still cancels its context once Wait returns
+	g, ctx = p.ErrGroupWithContext(context.Background())
+	g.Go(func() error { return nil })
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("context not cancelled after Wait")
+	}
+}
+
+func TestErrGroupSetLimit(t *testing.T) {
+	for _, limit := range []int{1, 3} {
+		groups := map[string]*ErrGroup{
+			"pool":       New(WithMaxConcurrency(8)).ErrGroup(),
+			"zero value": new(ErrGroup),
+		}
+		for name, g := range groups {
+			t.Run(fmt.Sprintf("%s/limit %d", name, limit), func(t *testing.T) {
+				g.SetLimit(limit)
+				var active, peak atomic.Int32
+				for i := 0; i < 20; i++ {
+					g.Go(func() error {
+						n := active.Add(1)
+						for {
+							old := peak.Load()
+							if n <= old || peak.CompareAndSwap(old, n) {
+								break
+							}
+						}
+						time.Sleep(time.Millisecond)
+						active.Add(-1)
+						return nil
+					})
+				}
+				if err := g.Wait(); err != nil {
+					t.Fatal(err)
+				}
+				if got := peak.Load(); got > int32(limit) {
+					t.Fatalf("%d functions were active at once, limit %d", got, limit)
+				}
+			})
+		}
+	}
+}
+
+func TestErrGroupTryGo(t *testing.T) {
+	g := New(WithMaxConcurrency(4)).ErrGroup()
+	g.SetLimit(1)
+
+	release := make(chan struct{})
+	if !g.TryGo(func() error { <-release; return nil }) {
+		t.Fatal("TryGo() = false on an empty group")
+	}
+	if g.TryGo(func() error { return nil }) {
+		t.Fatal("TryGo() = true with the limit reached")
+	}
+	close(release)
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if !g.TryGo(func() error { return nil }) {
+		t.Fatal("TryGo() = false after the group drained")
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestErrGroupTerminatedPool(t *testing.T) {
+	p := New(WithMaxConcurrency(2))
+	p.Run(func() error { return nil })
+	p.Wait()
+
+	g := p.ErrGroup()
+	var ran atomic.Bool
+	g.Go(func() error {
+		ran.Store(true)
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- g.Wait() }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrPoolTerminated) {
+			t.Fatalf("Wait() = %v, want ErrPoolTerminated", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait() blocked on a terminated pool")
+	}
+	if ran.Load() {
+		t.Fatal("function ran on a terminated pool")
+	}
+}
+
+func TestErrGroupUnrunFunctions(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name string
+		opts []Option
+		// run submits the group's functions; release unblocks any held
+		run  func(p *Pool, g *ErrGroup, release <-chan struct{})
+		want func(error) bool
+	}{
+		{
+			name: "dropped by fail-fast",
+			opts: []Option{WithFailFast()},
+			run: func(p *Pool, g *ErrGroup, release <-chan struct{}) {
+				g.Go(func() error { <-release; return errFailed })
+				g.Go(func() error { t.Error("function ran after the failure"); return nil })
+			},
+			want: func(err error) bool { return errors.Is(err, errFailed) },
+		},
+		{
+			name: "dropped by Cancel",
+			run: func(p *Pool, g *ErrGroup, release <-chan struct{}) {
+				g.Go(func() error { <-release; return nil })
+				g.Go(func() error { t.Error("function ran after Cancel"); return nil })
+				p.Cancel()
+			},
+			want: func(err error) bool { return errors.Is(err, ErrCancelled) },
+		},
+		{
+			name: "rejected by a full queue",
+			opts: []Option{WithMaxQueue(1)},
+			run: func(p *Pool, g *ErrGroup, release <-chan struct{}) {
+				for i := 0; i < 3; i++ {
+					g.Go(func() error { <-release; return nil })
+				}
+			},
+			want: func(err error) bool { return errors.Is(err, ErrQueueFull) },
+		},
+		{
+			name: "panicked",
+			run: func(p *Pool, g *ErrGroup, release <-chan struct{}) {
+				g.Go(func() error { panic("boom") })
+			},
+			want: func(err error) bool {
+				var pe *PanicError
+				return errors.As(err, &pe) && pe.Value == "boom"
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// one slot, so the first function holds back the rest
+			p := New(append(tt.opts, WithMaxConcurrency(1))...)
+			g := p.ErrGroup()
+			release := make(chan struct{})
+			tt.run(p, g, release)
+			close(release)
+
+			done := make(chan error, 1)
+			go func() { done <- g.Wait() }()
+			select {
+			case err := <-done:
+				if !tt.want(err) {
+					t.Errorf("Wait() = %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Wait() blocked on a function that never ran")
+			}
+		})
+	}
+}
+
+func TestTaskGroups(t *testing.T) {
+	p := NewSimple(4)
+	plain := p.Run(func() error { return nil })
+
+	groups := make([]*TaskGroup, 2)
+	ids := make([]map[uint64]bool, len(groups))
+	results := make([][]TaskResult, len(groups))
+	var wg sync.WaitGroup
+	for i := range groups {
+		groups[i] = p.Group()
+		ids[i] = make(map[uint64]bool)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				ids[i][groups[i].Run(func() error { time.Sleep(10 * time.Microsecond); return nil })] = true
+			}
+			results[i] = groups[i].Wait()
+		}()
+	}
+	wg.Wait()
+
+	for i, rs := range results {
+		if len(rs) != 100 {
+			t.Fatalf("group %d: Wait() returned %d results, want 100", i, len(rs))
+		}
+		for _, r := range rs {
+			if !ids[i][r.ID] {
+				t.Fatalf("group %d: got result of task %d, which it did not submit", i, r.ID)
+			}
+		}
+	}
+	if rs := p.Wait(); len(rs) != 1 || rs[0].ID != plain {
+		t.Fatalf("Pool.Wait() = %+v, want only the task submitted outside the groups", rs)
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	p := NewSimple(3)
+	var wg sync.WaitGroup
+	for caller := 0; caller < 2; caller++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tasks := make([]func() error, 20)
+			for i := range tasks {
+				// later tasks finish first, so completion order differs
+				// from submission order
+				tasks[i] = func() error {
+					time.Sleep(time.Duration(20-i) * 100 * time.Microsecond)
+					return fmt.Errorf("%d-%d", caller, i)
+				}
+			}
+			results := p.RunBatch(tasks)
+			if len(results) != len(tasks) {
+				t.Errorf("caller %d: RunBatch() = %d results, want %d", caller, len(results), len(tasks))
+				return
+			}
+			for i, r := range results {
+				if want := fmt.Sprintf("%d-%d", caller, i); r.Err == nil || r.Err.Error() != want {
+					t.Errorf("caller %d: result %d = %v, want %s", caller, i, r.Err, want)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if results := p.Wait(); len(results) != 0 {
+		t.Errorf("Wait() = %d results, want the batches' results kept out of it", len(results))
+	}
+}
+
+func TestPar2(t *testing.T) {
+	errFailed := errors.New("failed")
+	p := NewSimple(2)
+	start := time.Now()
+	slow, fast := p.Par2(
+		func() error { time.Sleep(50 * time.Millisecond); return nil },
+		func() error { time.Sleep(40 * time.Millisecond); return errFailed },
+	)
+	// one after the other they would take 90ms
+	if elapsed := time.Since(start); elapsed > 80*time.Millisecond {
+		t.Errorf("Par2() took %v, want the tasks run in parallel", elapsed)
+	}
+	if !slow.Success || slow.Duration < 50*time.Millisecond {
+		t.Errorf("first result = %+v, want the slow success", slow)
+	}
+	if !errors.Is(fast.Err, errFailed) || fast.Duration >= slow.Duration {
+		t.Errorf("second result = %+v, want the fast failure", fast)
+	}
+}
+
+func TestRunConcurrentFromTask(t *testing.T) {
+	// one slot, held by the task calling RunConcurrent, so the nested
+	// tasks only finish because the caller runs them itself
+	p := NewSimple(1)
+	var first, second TaskResult
+	var nested []TaskResult
+	p.Run(func() error {
+		first, second = p.Par2(
+			func() error { time.Sleep(10 * time.Millisecond); return nil },
+			func() error {
+				nested = p.RunConcurrent(func() error { return nil }, func() error { return errors.New("failed") })
+				return nil
+			},
+		)
+		return nil
+	})
+
+	done := make(chan []TaskResult)
+	go func() { done <- p.Wait() }()
+	var results []TaskResult
+	select {
+	case results = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunConcurrent inside a task deadlocked")
+	}
+	if len(results) != 1 || !results[0].Success {
+		t.Fatalf("Wait() = %+v, want only the outer task's result", results)
+	}
+	if !first.Success || !second.Success || first.ID >= second.ID {
+		t.Errorf("Par2() = %+v, %+v, want two successes in order", first, second)
+	}
+	if len(nested) != 2 || !nested[0].Success || nested[1].Err == nil {
+		t.Errorf("nested RunConcurrent() = %+v, want a success and a failure", nested)
+	}
+	if s := p.Stats(); s.Submitted != 5 || s.Completed != 4 || s.Failed != 1 {
+		t.Errorf("Stats() = %d submitted, %d completed, %d failed, want 5, 4 and 1", s.Submitted, s.Completed, s.Failed)
+	}
+}
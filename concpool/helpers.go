@@ -0,0 +1,149 @@
+package concpool
+
+import (
+	"context"
+	"sync"
+)
+
+// MappedResult is the outcome of applying a Map function to one input.
+// Output holds whatever fn returned, even when it also returned an error.
+// Err is also set when the task never ran, e.g. because the pool was
+// cancelled (ErrCancelled) or fn panicked (*PanicError).
+type MappedResult[T, R any] struct {
+	Input  T
+	Output R
+	Err    error
+	Index  int
+}
+
+// Map calls fn on every item in items, using p to run up to its
+// concurrency limit of calls at once, and returns the results in input
+// order: result i belongs to items[i].
+//
+// Map submits one task per item and then waits on the pool, so results of
+// any other tasks submitted to p are collected and thrown away. Give Map a
+// fresh pool of its own, and Reset it before reusing it afterwards.
+func Map[T, R any](p *Pool, items []T, fn func(T) (R, error)) []MappedResult[T, R] {
+	results := make([]MappedResult[T, R], len(items))
+	futures := make([]*Future, len(items))
+	for i, item := range items {
+		results[i] = MappedResult[T, R]{Input: item, Index: i}
+		futures[i] = p.Submit(func() error {
+			out, err := fn(item)
+			results[i].Output = out
+			return err
+		})
+	}
+
+	p.Wait()
+
+	for i, f := range futures {
+		results[i].Err = f.Get().Err
+	}
+	return results
+}
+
+// Filter returns the items for which fn returns true, in input order,
+// calling fn concurrently through p like Map does. Items for which fn
+// fails are left out, and the error of the first of them in input order is
+// returned alongside the rest.
+func Filter[T any](p *Pool, items []T, fn func(T) (bool, error)) ([]T, error) {
+	var (
+		kept     []T
+		firstErr error
+	)
+	for _, r := range Map(p, items, fn) {
+		if r.Err != nil {
+			if firstErr == nil {
+				firstErr = r.Err
+			}
+			continue
+		}
+		if r.Output {
+			kept = append(kept, r.Input)
+		}
+	}
+	return kept, firstErr
+}
+
+// Reduce waits on p like ForEachResult and folds every result into an
+// accumulator, starting from initial: acc = fn(acc, r). fn is called on
+// the calling goroutine, one result at a time, so it needs no locking.
+func Reduce[T any](p *Pool, initial T, fn func(T, TaskResult) T) T {
+	acc := initial
+	p.ForEachResult(func(r TaskResult) {
+		acc = fn(acc, r)
+	})
+	return acc
+}
+
+// RunAndCollectErrors submits every task in tasks to p, waits for the pool
+// and returns the errors of the tasks that failed, or nil if all of them
+// succeeded. Like Map, it collects every result of p, so use a pool of its
+// own.
+func RunAndCollectErrors(p *Pool, tasks []func() error) []error {
+	p.RunAll(tasks)
+	return Errors(p.Wait())
+}
+
+// RunAndCollectErrorsContext is like RunAndCollectErrors, but binds every
+// task to ctx as RunWithContext does: once ctx is done, the tasks that
+// haven't started are dropped and their ctx.Err() is among the errors
+// returned.
+func RunAndCollectErrorsContext(ctx context.Context, p *Pool, tasks []func() error) []error {
+	for _, task := range tasks {
+		p.RunWithContext(ctx, task)
+	}
+	return Errors(p.Wait())
+}
+
+// MustRunAll submits every task in tasks to p and waits for the pool. If
+// any task failed it panics with a *MultiError holding every failure (see
+// CollectErrors).
+func MustRunAll(p *Pool, tasks []func() error) {
+	p.RunAll(tasks)
+	if err := CollectErrors(p.Wait()); err != nil {
+		panic(err)
+	}
+}
+
+// FanIn waits for all pools at once, since each only makes progress while
+// it is being waited on, and returns their results combined, grouped by
+// pool in the order the pools were given. IDs are assigned per pool, so
+// they are only unique within one pool's results.
+func FanIn(pools ...*Pool) []TaskResult {
+	return waitAll(pools)
+}
+
+// FanInOrdered is like FanIn but keeps each pool's results apart:
+// results[i] holds those of pools[i].
+func FanInOrdered(pools ...*Pool) [][]TaskResult {
+	return waitEach(pools)
+}
+
+// FanInContext is like FanIn but waits with WaitContext, so once ctx is
+// done it returns the results collected so far and ctx.Err(). The work
+// left in the pools is not cancelled.
+func FanInContext(ctx context.Context, pools ...*Pool) ([]TaskResult, error) {
+	perPool := make([][]TaskResult, len(pools))
+	errs := make([]error, len(pools))
+	var wg sync.WaitGroup
+	for i, p := range pools {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			perPool[i], errs[i] = p.WaitContext(ctx)
+		}()
+	}
+	wg.Wait()
+
+	var results []TaskResult
+	var err error
+	for i, r := range perPool {
+		results = append(results, r...)
+		if err == nil {
+			err = errs[i]
+		}
+	}
+	return results, err
+}
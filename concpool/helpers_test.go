@@ -0,0 +1,269 @@
+package concpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMap(t *testing.T) {
+	errNegative := errors.New("negative")
+	items := []int{3, -1, 4, 1, -5, 9}
+	results := Map(NewSimple(3), items, func(n int) (string, error) {
+		if n < 0 {
+			return "", errNegative
+		}
+		return strconv.Itoa(n * n), nil
+	})
+	if len(results) != len(items) {
+		t.Fatalf("got %d results, want %d", len(results), len(items))
+	}
+	for i, r := range results {
+		if r.Index != i || r.Input != items[i] {
+			t.Fatalf("results[%d] = %+v, out of input order", i, r)
+		}
+		switch {
+		case items[i] < 0 && !errors.Is(r.Err, errNegative):
+			t.Errorf("results[%d].Err = %v, want %v", i, r.Err, errNegative)
+		case items[i] >= 0 && (r.Err != nil || r.Output != strconv.Itoa(items[i]*items[i])):
+			t.Errorf("results[%d] = %+v", i, r)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	errOdd := errors.New("odd")
+	tests := []struct {
+		name    string
+		items   []int
+		want    []int
+		wantErr error
+	}{
+		{"all kept", []int{2, 4, 6}, []int{2, 4, 6}, nil},
+		{"some dropped", []int{2, 10, 4, 12}, []int{2, 4}, nil},
+		{"failures left out", []int{2, 3, 4, 5}, []int{2, 4}, errOdd},
+		{"empty", nil, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Filter(NewSimple(2), tt.items, func(n int) (bool, error) {
+				if n%2 == 1 {
+					return false, errOdd
+				}
+				return n < 10, nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Filter() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Filter() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Filter() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkMap compares Map with the fan-out it replaces: a goroutine per
+// item, bounded by a semaphore the size of the pool.
+func BenchmarkMap(b *testing.B) {
+	items := make([]int, 10000)
+	for i := range items {
+		items[i] = i
+	}
+	square := func(n int) (int, error) { return n * n, nil }
+	workers := runtime.GOMAXPROCS(0)
+
+	b.Run("Map", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			Map(NewSimple(workers), items, square)
+		}
+	})
+	b.Run("hand-rolled", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			results := make([]MappedResult[int, int], len(items))
+			sem := make(chan struct{}, workers)
+			var wg sync.WaitGroup
+			for j, item := range items {
+				sem <- struct{}{}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					out, err := square(item)
+					results[j] = MappedResult[int, int]{Input: item, Output: out, Err: err, Index: j}
+					<-sem
+				}()
+			}
+			wg.Wait()
+		}
+	})
+}
+
+func TestRunAndCollectErrors(t *testing.T) {
+	errFailed := errors.New("failed")
+	succeed := func() error { return nil }
+	fail := func() error { return errFailed }
+	tests := []struct {
+		name  string
+		tasks []func() error
+		want  int
+	}{
+		{"all succeed", []func() error{succeed, succeed, succeed}, 0},
+		{"partial failure", []func() error{succeed, fail, succeed, fail}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := RunAndCollectErrors(NewSimple(2), tt.tasks)
+			if tt.want == 0 && errs != nil {
+				t.Fatalf("RunAndCollectErrors() = %v, want nil", errs)
+			}
+			if len(errs) != tt.want {
+				t.Fatalf("RunAndCollectErrors() = %v, want %d errors", errs, tt.want)
+			}
+			for _, err := range errs {
+				if !errors.Is(err, errFailed) {
+					t.Errorf("unexpected error %v", err)
+				}
+			}
+
+			errs = RunAndCollectErrorsContext(context.Background(), NewSimple(2), tt.tasks)
+			if len(errs) != tt.want {
+				t.Fatalf("RunAndCollectErrorsContext() = %v, want %d errors", errs, tt.want)
+			}
+
+			panicked := func() (v any) {
+				defer func() { v = recover() }()
+				MustRunAll(NewSimple(2), tt.tasks)
+				return nil
+			}()
+			var me *MultiError
+			if tt.want == 0 && panicked != nil {
+				t.Fatalf("MustRunAll panicked with %v", panicked)
+			}
+			if tt.want > 0 {
+				if err, ok := panicked.(error); !ok || !errors.As(err, &me) || len(me.Errors) != tt.want {
+					t.Fatalf("MustRunAll panicked with %v, want a *MultiError of %d errors", panicked, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunAndCollectErrorsContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var ran atomic.Int32
+	tasks := []func() error{
+		func() error { ran.Add(1); return nil },
+		func() error { ran.Add(1); return nil },
+	}
+	errs := RunAndCollectErrorsContext(ctx, NewSimple(1), tasks)
+	if len(errs) != 2 || ran.Load() != 0 {
+		t.Fatalf("got %v after %d runs, want 2 errors without running", errs, ran.Load())
+	}
+	for _, err := range errs {
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want %v", err, context.Canceled)
+		}
+	}
+}
+
+func TestReduce(t *testing.T) {
+	errFailed := errors.New("failed")
+	submit := func(p *Pool) {
+		for i := 0; i < 30; i++ {
+			p.Run(func() error {
+				if i%3 == 0 {
+					return errFailed
+				}
+				return nil
+			})
+		}
+	}
+
+	reduced := NewSimple(4)
+	submit(reduced)
+	failures := Reduce(reduced, 0, func(n int, r TaskResult) int {
+		if !r.Success {
+			n++
+		}
+		return n
+	})
+
+	waited := NewSimple(4)
+	submit(waited)
+	if want := len(Errors(waited.Wait())); failures != want || failures != 10 {
+		t.Fatalf("Reduce counted %d failures, Errors found %d, want 10", failures, want)
+	}
+}
+
+// namedPool returns a pool of two workers with n tasks named after the
+// pool, each sleeping for d.
+func namedPool(name string, n int, d time.Duration) *Pool {
+	p := NewSimple(2)
+	for i := 0; i < n; i++ {
+		p.RunNamed(fmt.Sprintf("%s-%d", name, i), func() error { time.Sleep(d); return nil })
+	}
+	return p
+}
+
+func TestFanIn(t *testing.T) {
+	// each pool takes 40ms on its own
+	start := time.Now()
+	results := FanIn(namedPool("a", 4, 20*time.Millisecond), namedPool("b", 2, 40*time.Millisecond), namedPool("c", 8, 10*time.Millisecond))
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("FanIn() took %v, want the pools waited on at once", d)
+	}
+	if len(results) != 14 || HasErrors(results) {
+		t.Fatalf("FanIn() = %d results, want 14 successes", len(results))
+	}
+	counts := make(map[byte]int)
+	for _, r := range results {
+		counts[r.Name[0]]++
+	}
+	if counts['a'] != 4 || counts['b'] != 2 || counts['c'] != 8 {
+		t.Errorf("FanIn() results per pool = %v, want a:4 b:2 c:8", counts)
+	}
+}
+
+func TestFanInOrdered(t *testing.T) {
+	grouped := FanInOrdered(namedPool("a", 5, 0), namedPool("b", 7, 0), namedPool("c", 3, 0))
+	if len(grouped) != 3 {
+		t.Fatalf("FanInOrdered() = %d groups, want 3", len(grouped))
+	}
+	for i, want := range []int{5, 7, 3} {
+		if len(grouped[i]) != want {
+			t.Errorf("group %d has %d results, want %d", i, len(grouped[i]), want)
+		}
+		for _, r := range grouped[i] {
+			if r.Name[0] != "abc"[i] {
+				t.Errorf("group %d holds %s", i, r.Name)
+			}
+		}
+	}
+}
+
+func TestFanInContext(t *testing.T) {
+	results, err := FanInContext(context.Background(), namedPool("a", 2, 0), namedPool("b", 3, 0))
+	if err != nil || len(results) != 5 {
+		t.Fatalf("FanInContext() = %d results, %v, want 5 and nil", len(results), err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	slow := namedPool("slow", 20, 10*time.Millisecond)
+	results, err = FanInContext(ctx, namedPool("fast", 2, 0), slow)
+	if err != context.DeadlineExceeded || len(results) < 2 || len(results) >= 22 {
+		t.Errorf("FanInContext() = %d results, %v, want the partial results and context.DeadlineExceeded", len(results), err)
+	}
+	slow.Wait()
+}
@@ -0,0 +1,65 @@
+package concpool
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// JournalEntry records one task run by a pool created with WithWorkJournal.
+// It marshals to JSON with Err as its message, so a journal can be shipped
+// to a monitoring system as-is.
+type JournalEntry struct {
+	TaskID     uint64    `json:"task_id"`
+	Name       string    `json:"name,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Success    bool      `json:"success"`
+	Err        error     `json:"-"`
+}
+
+// MarshalJSON encodes e, with Err as an "err" string field.
+func (e JournalEntry) MarshalJSON() ([]byte, error) {
+	type entry JournalEntry
+	var msg string
+	if e.Err != nil {
+		msg = e.Err.Error()
+	}
+	return json.Marshal(struct {
+		entry
+		Err string `json:"err,omitempty"`
+	}{entry(e), msg})
+}
+
+// Journal returns the entries recorded so far by a pool created with
+// WithWorkJournal, in the order the tasks finished. Call it after Wait for
+// the complete journal of a batch. It returns nil for other pools.
+func (p *Pool) Journal() []JournalEntry {
+	p.lazyInit()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.journal == nil {
+		return nil
+	}
+	return append([]JournalEntry(nil), p.journal...)
+}
+
+// recordJournal adds the entry for r to the journal.
+func (p *Pool) recordJournal(r TaskResult) {
+	e := JournalEntry{
+		TaskID:     r.ID,
+		Name:       r.Name,
+		StartedAt:  r.StartedAt,
+		FinishedAt: r.StartedAt.Add(r.Duration),
+		Success:    r.Success,
+		Err:        r.Err,
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.journal == nil {
+		// room for every task submitted so far; append grows it for
+		// the rest
+		p.journal = make([]JournalEntry, 0, p.counts.submitted.Load())
+	}
+	p.journal = append(p.journal, e)
+}
@@ -0,0 +1,56 @@
+package concpool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWorkJournal(t *testing.T) {
+	p := New(WithMaxConcurrency(4), WithWorkJournal())
+	for i := 0; i < 30; i++ {
+		p.RunNamed(fmt.Sprint("task-", i), func() error {
+			time.Sleep(time.Millisecond)
+			if i == 3 {
+				return errors.New("bad input")
+			}
+			return nil
+		})
+	}
+	p.Wait()
+
+	journal := p.Journal()
+	if len(journal) != 30 {
+		t.Fatalf("Journal() = %d entries, want 30", len(journal))
+	}
+	ids := make(map[uint64]bool)
+	for _, e := range journal {
+		ids[e.TaskID] = true
+		if e.StartedAt.IsZero() || e.FinishedAt.Before(e.StartedAt) {
+			t.Errorf("task %d: started %v, finished %v", e.TaskID, e.StartedAt, e.FinishedAt)
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			t.Fatalf("json.Marshal() error = %v", err)
+		}
+		var decoded map[string]any
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("json.Unmarshal(%s) error = %v", data, err)
+		}
+		if decoded["name"] != e.Name || decoded["success"] != e.Success {
+			t.Errorf("marshalled %+v as %s", e, data)
+		}
+		if wantErr := !e.Success; (decoded["err"] == "bad input") != wantErr {
+			t.Errorf("marshalled %+v as %s, want err only for the failure", e, data)
+		}
+	}
+	if len(ids) != 30 {
+		t.Errorf("journal has %d distinct tasks, want 30", len(ids))
+	}
+
+	if j := New().Journal(); j != nil {
+		t.Errorf("Journal() without WithWorkJournal = %v, want nil", j)
+	}
+}
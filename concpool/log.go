@@ -0,0 +1,82 @@
+package concpool
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+)
+
+// The pool's log messages are emitted outside p.mu, so a handler may call
+// back into the pool. The task events are also recorded by the pool's
+// TestObserver; the callers only call them if observed reports true.
+
+// observed reports whether task events are logged or observed.
+func (p *Pool) observed() bool {
+	return p.logger != nil || p.observer.Load() != nil
+}
+
+// logSubmitted logs that t was queued, leaving depth tasks in the queue.
+func (p *Pool) logSubmitted(t *job, depth int) {
+	if o := p.observer.Load(); o != nil {
+		o.record(EventSubmitted, t.id, t.name, nil)
+	}
+	if p.logger == nil {
+		return
+	}
+	p.logger.Debug("task submitted", withMeta(t.meta, "task_id", t.id, "task_name", t.name, "queue_depth", depth)...)
+}
+
+// logStarted logs that t started, with running tasks now in flight.
+func (p *Pool) logStarted(t *job, running int) {
+	if o := p.observer.Load(); o != nil {
+		o.record(EventStarted, t.id, t.name, nil)
+	}
+	if p.logger == nil {
+		return
+	}
+	p.logger.Debug("task started", withMeta(t.meta, "task_id", t.id, "task_name", t.name, "running", running)...)
+}
+
+// logFinished logs the outcome of a task that ran, at Info level if it
+// succeeded and at Error level otherwise.
+func (p *Pool) logFinished(r TaskResult) {
+	if o := p.observer.Load(); o != nil {
+		o.record(EventCompleted, r.ID, r.Name, r.Err)
+	}
+	if p.logger == nil {
+		return
+	}
+
+	level := slog.LevelInfo
+	attrs := []any{"task_id", r.ID, "task_name", r.Name, "duration", r.Duration, "attempts", r.Attempts}
+	if r.Err != nil {
+		level = slog.LevelError
+		attrs = append(attrs, "error", r.Err)
+	}
+	p.logger.Log(context.Background(), level, "task completed", withMeta(r.Meta, attrs...)...)
+}
+
+// withMeta appends a task's RunWithMeta metadata to attrs, as a "meta"
+// group, if it has any.
+func withMeta(meta map[string]string, attrs ...any) []any {
+	if len(meta) == 0 {
+		return attrs
+	}
+	group := make([]any, 0, len(meta))
+	for _, k := range slices.Sorted(maps.Keys(meta)) {
+		group = append(group, slog.String(k, meta[k]))
+	}
+	return append(attrs, slog.Group("meta", group...))
+}
+
+// logTerminated logs that the pool finished its batch, with its Stats.
+func (p *Pool) logTerminated() {
+	s := p.Stats()
+	p.logger.Info("pool terminated",
+		"submitted", s.Submitted,
+		"completed", s.Completed,
+		"failed", s.Failed,
+		"cancelled", s.Cancelled,
+	)
+}
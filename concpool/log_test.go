@@ -0,0 +1,101 @@
+package concpool
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestWithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	p := New(WithMaxConcurrency(1), WithName("fetcher"), WithLogger(logger))
+	p.RunNamed("ok", func() error { return nil })
+	p.RunNamed("broken", func() error { return errors.New("dial timeout") })
+	p.Wait()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{
+		`level=DEBUG msg="task submitted" pool=fetcher task_id=1 task_name=ok queue_depth=1`,
+		`level=DEBUG msg="task submitted" pool=fetcher task_id=2 task_name=broken queue_depth=2`,
+		`level=DEBUG msg="task started" pool=fetcher task_id=1 task_name=ok running=1`,
+		`level=INFO msg="task completed" pool=fetcher task_id=1 task_name=ok duration=`,
+		`level=DEBUG msg="task started" pool=fetcher task_id=2 task_name=broken running=1`,
+		`level=ERROR msg="task completed" pool=fetcher task_id=2 task_name=broken duration=`,
+		`level=INFO msg="pool terminated" pool=fetcher submitted=2 completed=1 failed=1 cancelled=0`,
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d log lines, want %d:\n%s", len(lines), len(want), buf.String())
+	}
+	for i, line := range lines {
+		// drop the time= prefix
+		_, line, _ = strings.Cut(line, " ")
+		if !strings.HasPrefix(line, want[i]) {
+			t.Errorf("line %d:\ngot  %s\nwant %s...", i, line, want[i])
+		}
+	}
+	if !strings.HasSuffix(lines[5], `error="dial timeout"`) {
+		t.Errorf("failure line does not include the error: %s", lines[5])
+	}
+}
+
+func TestWithName(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		wantName string
+	}{
+		{"unnamed", nil, "default"},
+		{"import", []Option{WithName("import-worker")}, "import-worker"},
+		{"export", []Option{WithName("export")}, "export"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buf, nil))
+			p := New(append(tt.opts, WithLogger(logger))...)
+			p.Run(func() error { panic("boom") })
+			r := p.Wait()[0]
+
+			if got := p.Name(); got != tt.wantName {
+				t.Errorf("Name() = %q, want %q", got, tt.wantName)
+			}
+			if got := p.Stats().Name; got != tt.wantName {
+				t.Errorf("Stats().Name = %q, want %q", got, tt.wantName)
+			}
+			logged := strings.TrimSpace(buf.String())
+			if n := strings.Count(logged, "\n") + 1; n != strings.Count(logged, " pool="+tt.wantName+" ") {
+				t.Errorf("not every log line is labeled pool=%s:\n%s", tt.wantName, logged)
+			}
+			if msg := r.Err.Error(); (tt.opts != nil) != strings.HasPrefix(msg, fmt.Sprintf("pool %q", tt.wantName)) {
+				t.Errorf("panic error %q, want the pool name only when one was set", msg)
+			}
+		})
+	}
+}
+
+func TestRunWithMeta(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	p := New(WithMaxConcurrency(2), WithLogger(logger))
+	meta := map[string]string{"request_id": "r-1", "user": "u-7"}
+	tagged := p.RunWithMeta(meta, func() error { return nil })
+	// the pool keeps its own copy
+	meta["request_id"] = "changed"
+	plain := p.Run(func() error { return nil })
+	results := p.WaitMap()
+
+	if got := results[tagged].Meta; got["request_id"] != "r-1" || got["user"] != "u-7" || len(got) != 2 {
+		t.Errorf("Meta = %v, want the map as it was at submission", got)
+	}
+	if got := results[plain].Meta; got != nil {
+		t.Errorf("Meta of a task without metadata = %v, want nil", got)
+	}
+	// submitted, started and completed
+	if n := strings.Count(buf.String(), `"meta":{"request_id":"r-1","user":"u-7"}`); n != 3 {
+		t.Errorf("metadata appears in %d log lines, want 3:\n%s", n, buf.String())
+	}
+}
@@ -0,0 +1,82 @@
+package concpool
+
+import (
+	"log"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// Middleware wraps a task to add behaviour around it, such as logging or
+// timing. It is given the task (or the next middleware) as next and returns
+// the function the pool calls instead.
+type Middleware func(next func() error) func() error
+
+// Use registers middleware that wraps every task the pool runs. The first
+// middleware registered is the outermost, so it runs first and returns
+// last. A retried task goes through the chain again on every attempt.
+//
+// Middleware must be registered before any task is submitted; Use panics
+// otherwise.
+func (p *Pool) Use(middleware ...Middleware) {
+	p.lazyInit()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.lastID.Load() > 0 {
+		panic("concpool: Use called after tasks were submitted")
+	}
+	p.middleware = append(p.middleware, middleware...)
+}
+
+// wrap applies the registered middleware to fn.
+func (p *Pool) wrap(fn func() error) func() error {
+	for i := len(p.middleware) - 1; i >= 0; i-- {
+		fn = p.middleware[i](fn)
+	}
+	return fn
+}
+
+// LoggingMiddleware logs how long each task ran and the error it returned,
+// if any, to logger.
+func LoggingMiddleware(logger *log.Logger) Middleware {
+	return func(next func() error) func() error {
+		return func() error {
+			start := time.Now()
+			err := next()
+			if err != nil {
+				logger.Printf("concpool: task failed after %v: %v", time.Since(start), err)
+			} else {
+				logger.Printf("concpool: task finished in %v", time.Since(start))
+			}
+			return err
+		}
+	}
+}
+
+// RecoveryMiddleware turns a panic in the wrapped function into a
+// *PanicError, like the pool's own panic recovery. It is useful together
+// with WithoutPanicRecovery(), to recover panics in the task while still
+// letting ones in the outer middleware through.
+func RecoveryMiddleware() Middleware {
+	return func(next func() error) func() error {
+		return func() (err error) {
+			defer func() {
+				if v := recover(); v != nil {
+					err = &PanicError{Value: v, Stack: debug.Stack()}
+				}
+			}()
+			return next()
+		}
+	}
+}
+
+// MetricsMiddleware atomically increments *counter every time a task runs.
+func MetricsMiddleware(counter *int64) Middleware {
+	return func(next func() error) func() error {
+		return func() error {
+			atomic.AddInt64(counter, 1)
+			return next()
+		}
+	}
+}
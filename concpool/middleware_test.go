@@ -0,0 +1,78 @@
+package concpool
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestUse(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	record := func(s string) {
+		mu.Lock()
+		calls = append(calls, s)
+		mu.Unlock()
+	}
+	trace := func(name string) Middleware {
+		return func(next func() error) func() error {
+			return func() error {
+				record(name + " before")
+				err := next()
+				record(name + " after")
+				return err
+			}
+		}
+	}
+
+	// one task at a time, so the calls of different tasks don't interleave
+	p := NewSimple(1)
+	p.Use(trace("outer"), trace("inner"))
+	for i := 0; i < 3; i++ {
+		p.Run(func() error { record("task"); return nil })
+	}
+	p.Wait()
+
+	want := strings.Repeat("outer before,inner before,task,inner after,outer after,", 3)
+	if got := strings.Join(calls, ",") + ","; got != want {
+		t.Fatalf("got %s\nwant %s", got, want)
+	}
+}
+
+func TestUseAfterRun(t *testing.T) {
+	p := NewSimple(1)
+	p.Run(func() error { return nil })
+	defer func() {
+		if recover() == nil {
+			t.Error("Use after Run did not panic")
+		}
+	}()
+	p.Use(RecoveryMiddleware())
+}
+
+func TestBuiltinMiddleware(t *testing.T) {
+	errFailed := errors.New("failed")
+	var buf bytes.Buffer
+	var count int64
+	p := New(WithMaxConcurrency(2), WithoutPanicRecovery())
+	p.Use(RecoveryMiddleware(), LoggingMiddleware(log.New(&buf, "", 0)), MetricsMiddleware(&count))
+	p.Run(func() error { return nil })
+	p.Run(func() error { return errFailed })
+	panicked := p.Run(func() error { panic("boom") })
+	results := p.WaitMap()
+
+	if count != 3 {
+		t.Errorf("MetricsMiddleware counted %d tasks, want 3", count)
+	}
+	logged := buf.String()
+	if strings.Count(logged, "concpool: task finished in") != 1 || strings.Count(logged, "concpool: task failed after") != 1 {
+		t.Errorf("LoggingMiddleware logged:\n%s", logged)
+	}
+	var pe *PanicError
+	if r := results[panicked]; !errors.As(r.Err, &pe) || pe.Value != "boom" {
+		t.Errorf("panicking task: got %+v, want a *PanicError from RecoveryMiddleware", r)
+	}
+}
@@ -0,0 +1,68 @@
+package concpool
+
+import (
+	"sync"
+	"time"
+)
+
+// EventKind is the kind of an Event recorded by a TestObserver.
+type EventKind string
+
+// The events a TestObserver records.
+const (
+	EventSubmitted EventKind = "submitted"
+	EventStarted   EventKind = "started"
+	EventCompleted EventKind = "completed"
+)
+
+// Event is one step in the life of a task, as recorded by a TestObserver.
+// Err is set for completed tasks that failed.
+type Event struct {
+	Kind   EventKind
+	TaskID uint64
+	Name   string
+	Time   time.Time
+	Err    error
+}
+
+// TestObserver records the events of a pool's tasks so tests can make
+// assertions about them. Get one with Pool.TestObserver.
+type TestObserver struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// TestObserver returns the pool's TestObserver, creating it on the first
+// call; it records every event from then on. Tasks registered with Defer
+// are not reported as submitted, and tasks that never run only as
+// submitted. Recording costs a lock per event, so it is meant for tests.
+func (p *Pool) TestObserver() *TestObserver {
+	p.observer.CompareAndSwap(nil, &TestObserver{})
+	return p.observer.Load()
+}
+
+// Events returns the events recorded so far, in the order they happened.
+func (o *TestObserver) Events() []Event {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Event(nil), o.events...)
+}
+
+// Count returns how many events of the given kind have been recorded.
+func (o *TestObserver) Count(kind EventKind) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n := 0
+	for _, e := range o.events {
+		if e.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+func (o *TestObserver) record(kind EventKind, id uint64, name string, err error) {
+	o.mu.Lock()
+	o.events = append(o.events, Event{Kind: kind, TaskID: id, Name: name, Time: time.Now(), Err: err})
+	o.mu.Unlock()
+}
@@ -0,0 +1,46 @@
+package concpool
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTestObserver(t *testing.T) {
+	errFailed := errors.New("failed")
+	p := New(WithMaxConcurrency(4))
+	o := p.TestObserver()
+	if p.TestObserver() != o {
+		t.Fatal("TestObserver() returned a different observer on the second call")
+	}
+	for i := 0; i < 10; i++ {
+		p.Run(func() error {
+			if i == 0 {
+				return errFailed
+			}
+			return nil
+		})
+	}
+	p.Wait()
+
+	for _, kind := range []EventKind{EventSubmitted, EventStarted, EventCompleted} {
+		if n := o.Count(kind); n != 10 {
+			t.Errorf("Count(%s) = %d, want 10", kind, n)
+		}
+	}
+	// each task's events are recorded in the order they happened
+	next := make(map[uint64]EventKind)
+	var failures int
+	for _, e := range o.Events() {
+		want := map[EventKind]EventKind{"": EventSubmitted, EventSubmitted: EventStarted, EventStarted: EventCompleted}[next[e.TaskID]]
+		if e.Kind != want {
+			t.Errorf("task %d: got %s event, want %s", e.TaskID, e.Kind, want)
+		}
+		next[e.TaskID] = e.Kind
+		if e.Err != nil {
+			failures++
+		}
+	}
+	if failures != 1 {
+		t.Errorf("%d events carry an error, want 1", failures)
+	}
+}
@@ -0,0 +1,362 @@
+package concpool
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Option configures optional Pool behaviour. Pass options to New.
+type Option func(*Pool)
+
+// WithMaxConcurrency sets how many tasks may run at once. Values below 1
+// are treated as 1, which is also the default.
+func WithMaxConcurrency(n int) Option {
+	return func(p *Pool) {
+		if n <= 0 {
+			n = 1
+		}
+		p.maxCount = n
+	}
+}
+
+// WithMaxQueue bounds the number of tasks waiting to start. Once n tasks
+// are queued, further submissions are rejected with ErrQueueFull instead of
+// growing the queue. Zero, the default, means unbounded.
+func WithMaxQueue(n int) Option {
+	return func(p *Pool) {
+		if n < 0 {
+			n = 0
+		}
+		p.maxQueue = n
+	}
+}
+
+// WithQueueCapacity preallocates the pool's queue to hold n tasks. The
+// queue is a ring buffer, so as long as it stays within its capacity,
+// queueing and starting tasks never reallocates it or leaves garbage
+// behind. What happens once n tasks are queued is up to WithOverflowGrow
+// (the default), WithOverflowDrop or WithOverflowBlock. Without this
+// option the queue starts with room for twice the concurrency limit and
+// grows as needed. It has no effect on pools created with WithQueue or
+// WithPriorityQueue.
+func WithQueueCapacity(n int) Option {
+	return func(p *Pool) {
+		if n < 0 {
+			n = 0
+		}
+		p.queueCapacity = n
+	}
+}
+
+// overflowPolicy is what a pool does with a task submitted to a full queue.
+type overflowPolicy int
+
+const (
+	overflowGrow overflowPolicy = iota
+	overflowDrop
+	overflowBlock
+)
+
+// WithOverflowGrow makes the queue grow past the capacity set by
+// WithQueueCapacity, doubling its buffer when full. This is the default. A
+// limit set by WithMaxQueue still applies.
+func WithOverflowGrow() Option {
+	return func(p *Pool) {
+		p.overflow = overflowGrow
+	}
+}
+
+// WithOverflowDrop makes the capacity set by WithQueueCapacity a hard limit,
+// like WithMaxQueue: tasks submitted once it is reached are rejected with
+// ErrQueueFull.
+func WithOverflowDrop() Option {
+	return func(p *Pool) {
+		p.overflow = overflowDrop
+	}
+}
+
+// WithOverflowBlock makes the capacity set by WithQueueCapacity, or the
+// limit set by WithMaxQueue, a limit that submitters wait for instead of
+// being rejected: Run and the other submission methods block until a
+// queued task has started and made room, or the pool is cancelled. As with
+// RunBounded, room is only made while the pool is being waited on, so the
+// producer runs alongside Wait and should Hold the pool until it has
+// submitted everything, or the pool may finish between two submissions.
+// Tasks must not submit to their own pool, since a full queue then waits
+// on workers that are themselves waiting.
+func WithOverflowBlock() Option {
+	return func(p *Pool) {
+		p.overflow = overflowBlock
+	}
+}
+
+// WithFailFast makes the pool cancel itself as soon as any task fails: the
+// remaining queued tasks are dropped as cancelled (see Pool.Cancel) and Wait
+// returns once the tasks that were already running have finished. Tasks
+// dropped without running don't count as failures.
+func WithFailFast() Option {
+	return func(p *Pool) {
+		p.failFast = true
+	}
+}
+
+// WithCancelledAsError makes WaitError and WaitErrors report the errors of
+// tasks that never ran because they were cancelled, expired or skipped
+// (ErrCancelled, a context's error, ErrTaskExpired, ErrSkipped). Without it
+// those results are not treated as failures by either method.
+func WithCancelledAsError() Option {
+	return func(p *Pool) {
+		p.cancelledAsError = true
+	}
+}
+
+// WithMaxFailures makes the pool cancel itself once n tasks have failed,
+// like WithFailFast does after the first failure. Along with the results
+// collected so far, Wait then returns an extra TaskResult with Err set to
+// ErrMaxFailuresExceeded, an ID of 0 and an Index of -1, so callers can
+// tell why the batch stopped early. Zero, the default, means no limit.
+func WithMaxFailures(n int) Option {
+	return func(p *Pool) {
+		if n < 0 {
+			n = 0
+		}
+		p.maxFailures = n
+	}
+}
+
+// WithPriorityQueue makes the pool start queued tasks by priority (see
+// Pool.RunWithPriority) instead of in FIFO order.
+func WithPriorityQueue() Option {
+	return func(p *Pool) {
+		p.usePriority = true
+	}
+}
+
+// WithQueue makes the pool keep its queued tasks in q, which decides the
+// order they start in. q must be empty and must not be used elsewhere while
+// the pool owns it. It takes precedence over WithPriorityQueue and WithLIFO.
+// If q has a PushPriority(task func() error, priority int) method, as
+// HeapQueue does, the pool pushes tasks with their RunWithPriority priority,
+// and if it has a Cap() int method, as RingQueue does, the pool's queue is
+// limited to that many tasks.
+func WithQueue(q Queue) Option {
+	return func(p *Pool) {
+		p.userQueue = q
+	}
+}
+
+// WithLIFO makes the pool start the most recently submitted task first
+// instead of the oldest, which suits depth-first workloads such as tasks
+// that submit their own subtasks. WithPriorityQueue takes precedence over
+// it.
+func WithLIFO() Option {
+	return func(p *Pool) {
+		p.lifo = true
+	}
+}
+
+// WithPanicRecovery recovers task panics and reports them as *PanicError
+// results. This is the default; the option undoes an earlier
+// WithoutPanicRecovery.
+func WithPanicRecovery() Option {
+	return func(p *Pool) {
+		p.recoverPanics = true
+	}
+}
+
+// WithoutPanicRecovery lets a panicking task crash the program as it would
+// outside the pool, instead of recovering the panic.
+func WithoutPanicRecovery() Option {
+	return func(p *Pool) {
+		p.recoverPanics = false
+	}
+}
+
+// WithPanicHandler lets fn decide what a task panic turns into: it is
+// called with the recovered value and its return value becomes the task's
+// error, so returning nil reports the task as successful. If fn panics in
+// turn, the task fails with the usual *PanicError. WithPanicHandler turns
+// panic recovery on.
+func WithPanicHandler(fn func(recovered interface{}) error) Option {
+	return func(p *Pool) {
+		p.recoverPanics = true
+		p.panicHandler = fn
+	}
+}
+
+// WithRetry retries every failing task up to n runs in total, with a short
+// pause between attempts, as if it had been submitted with RunWithRetry.
+// Tasks submitted with RunWithRetry or RunWithBackoff keep their own
+// settings.
+func WithRetry(n int) Option {
+	return func(p *Pool) {
+		if n <= 1 {
+			p.retry = nil
+			return
+		}
+		p.retry = &RetryOptions{MaxAttempts: n, InitialDelay: defaultRetryDelay}
+	}
+}
+
+// WithResultsBuffer sets the buffer size of the channel workers use to hand
+// results to Wait. By default it matches the concurrency limit the pool is
+// created with, so every worker can hand over a result without waiting for
+// Wait to catch up. A smaller buffer keeps fewer TaskResult values alive at
+// once, at the cost of workers blocking until their result is collected;
+// zero makes every hand-off synchronous.
+func WithResultsBuffer(n int) Option {
+	return func(p *Pool) {
+		if n < 0 {
+			n = 0
+		}
+		p.resultsBuffer = n
+	}
+}
+
+// WithAsyncDispatch makes workers hand each result to Wait from a goroutine
+// of its own instead of sending it themselves, so a worker whose result
+// can't be collected right away moves on to its next task rather than
+// blocking. This costs a goroutine per task and gives up the ordering of
+// the hand-off, so results may reach Wait in a different order than the
+// tasks finished. It is meant for high-throughput pools where workers are
+// measurably held up by a busy consumer; WithResultsBuffer is the cheaper
+// first thing to try.
+func WithAsyncDispatch() Option {
+	return func(p *Pool) {
+		p.asyncDispatch = true
+	}
+}
+
+// WithSyncDispatch makes workers send their results to Wait themselves,
+// waiting while the results buffer is full. This is the default; the
+// option exists to make the choice explicit, or to undo an earlier
+// WithAsyncDispatch in a list of options.
+func WithSyncDispatch() Option {
+	return func(p *Pool) {
+		p.asyncDispatch = false
+	}
+}
+
+// WithIdleTimeout makes workers that have had nothing to do for d exit,
+// instead of waiting for the pool to terminate, so a long-lived pool with
+// bursty traffic gives its goroutines back between bursts. New workers are
+// started as work arrives again, and WithMinWorkers keeps a floor of them
+// running. Zero, the default, keeps idle workers until the pool
+// terminates.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(p *Pool) {
+		if d < 0 {
+			d = 0
+		}
+		p.idleTimeout = d
+	}
+}
+
+// WithMinWorkers keeps at least n workers running, idle or not, so a hot
+// pool always has goroutines ready for new work. They are started by New
+// (see Pool.Prewarm) and again by Reset, and WithIdleTimeout never retires
+// workers below n. The pool's workers still exit when it terminates. n is
+// capped at the concurrency limit; zero, the default, sets no minimum.
+func WithMinWorkers(n int) Option {
+	return func(p *Pool) {
+		if n < 0 {
+			n = 0
+		}
+		p.minWorkers = n
+	}
+}
+
+// WithResultCallbackBuffer sets how many results may wait for the
+// OnResultBlocking callback before workers block on it. The default is 100;
+// zero makes every worker wait until the callback takes its result.
+func WithResultCallbackBuffer(n int) Option {
+	return func(p *Pool) {
+		if n < 0 {
+			n = 0
+		}
+		p.sinkBuffer = n
+	}
+}
+
+// WithRunCheckBuffer sets the buffer size of the channel workers use to wake
+// the event loop. The default of 1 is enough for the loop never to miss a
+// wake-up, since one pending signal covers any number of events; a larger
+// buffer only lets more signals pile up. Values below 1 are treated as 1.
+func WithRunCheckBuffer(n int) Option {
+	return func(p *Pool) {
+		if n < 1 {
+			n = 1
+		}
+		p.runCheckBuffer = n
+	}
+}
+
+// WithBurst sets how many tasks a pool created with NewRateLimited may
+// start back to back before its rate applies. The default is 1. Other
+// pools ignore it.
+func WithBurst(n int) Option {
+	return func(p *Pool) {
+		if n < 1 {
+			n = 1
+		}
+		p.burst = n
+	}
+}
+
+// WithName labels the pool, so pools sharing a logger or a dashboard can be
+// told apart. The name is attached to every log message the pool writes
+// (see WithLogger), included in the errors of tasks that panic and
+// reported in Stats. Names need not be unique, but unique names are the
+// most useful.
+func WithName(name string) Option {
+	return func(p *Pool) {
+		p.name = name
+	}
+}
+
+// WithLogger makes the pool log the lifecycle of its tasks to logger: when
+// a task is submitted or started (at Debug level), when it completes (at
+// Info level, or Error if it failed) and when the pool terminates (at Info
+// level, with its Stats). Every message carries a "pool" attribute with the
+// name set by WithName. Tasks that are dropped without running are not
+// logged. By default the pool doesn't log.
+func WithLogger(logger *slog.Logger) Option {
+	return func(p *Pool) {
+		p.logger = logger
+	}
+}
+
+// WithSubmissionTrace records the call stack of every Run (and the other
+// submission methods) and reports it in TaskResult.SubmissionStack, so a
+// failed result can be traced back to the code that submitted it. It costs
+// an allocation and a stack walk per submission, so it is off by default.
+func WithSubmissionTrace() Option {
+	return func(p *Pool) {
+		p.submissionTrace = true
+	}
+}
+
+// WithResultTransform makes the pool pass the result of every task it runs
+// through fn before reporting it, so callers can enrich results, turn
+// particular errors into successes, or strip sensitive data from errors.
+// The transformed result is what the pool counts as a success or failure
+// and what callbacks, subscribers, futures and Wait see. fn runs on the
+// worker goroutine and must not call methods of the pool. Results of tasks
+// that never ran are not transformed. Given several times, the transforms
+// apply in the order they were given.
+func WithResultTransform(fn func(TaskResult) TaskResult) Option {
+	return func(p *Pool) {
+		p.transforms = append(p.transforms, fn)
+	}
+}
+
+// WithWorkJournal makes the pool record a JournalEntry with the start and
+// finish times of every task it runs, for post-mortems; see Pool.Journal.
+// Tasks that never ran are not recorded. The journal is allocated for the
+// tasks submitted by the time the first one finishes, and grows from
+// there. It is cleared by Reset.
+func WithWorkJournal() Option {
+	return func(p *Pool) {
+		p.journalOn = true
+	}
+}
@@ -0,0 +1,220 @@
+package concpool
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithMaxConcurrency(t *testing.T) {
+	tests := []struct {
+		name string
+		pool *Pool
+		want int
+	}{
+		{"default", New(), 1},
+		{"set", New(WithMaxConcurrency(4)), 4},
+		{"below one", New(WithMaxConcurrency(-3)), 1},
+		{"NewSimple", NewSimple(6), 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pool.MaxConcurrency(); got != tt.want {
+				t.Fatalf("MaxConcurrency() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptionsCombine(t *testing.T) {
+	errFailed := errors.New("failed")
+	p := New(WithMaxConcurrency(2), WithMaxQueue(5), WithRetry(3), WithResultsBuffer(4))
+	var calls atomic.Int32
+	for i := 0; i < 8; i++ {
+		p.Run(func() error { calls.Add(1); return errFailed })
+	}
+
+	results := p.Wait()
+	full := 0
+	for _, r := range results {
+		switch {
+		case errors.Is(r.Err, ErrQueueFull):
+			full++
+		case r.Attempts != 3:
+			t.Errorf("task %d made %d attempts, want 3", r.ID, r.Attempts)
+		}
+	}
+	if len(results) != 8 || full != 3 {
+		t.Fatalf("got %d results with %d rejected, want 8 with 3", len(results), full)
+	}
+	if calls.Load() != 15 {
+		t.Fatalf("tasks were called %d times, want 5 tasks × 3 attempts", calls.Load())
+	}
+}
+
+func TestWithPanicRecovery(t *testing.T) {
+	tests := []struct {
+		name string
+		pool *Pool
+		want bool
+	}{
+		{"default", New(), true},
+		{"WithPanicRecovery", New(WithPanicRecovery()), true},
+		{"WithoutPanicRecovery", New(WithoutPanicRecovery()), false},
+		{"later option wins", New(WithoutPanicRecovery(), WithPanicRecovery()), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pool.recoverPanics; got != tt.want {
+				t.Fatalf("recoverPanics = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChannelBuffers(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []Option
+		results   int
+		runChecks int
+	}{
+		{"default", []Option{WithMaxConcurrency(8)}, 8, 1},
+		{"results", []Option{WithMaxConcurrency(8), WithResultsBuffer(64)}, 64, 1},
+		{"unbuffered results", []Option{WithMaxConcurrency(8), WithResultsBuffer(0)}, 0, 1},
+		{"run checks", []Option{WithRunCheckBuffer(16)}, 1, 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(tt.opts...)
+			if got := cap(p.results); got != tt.results {
+				t.Errorf("results buffer = %d, want %d", got, tt.results)
+			}
+			if got := cap(p.runCheckChannel); got != tt.runChecks {
+				t.Errorf("run check buffer = %d, want %d", got, tt.runChecks)
+			}
+		})
+	}
+}
+
+// BenchmarkResultsBuffer runs short tasks on 1000 workers with a results
+// buffer of one against the default of one slot per worker.
+func BenchmarkResultsBuffer(b *testing.B) {
+	const workers = 1000
+	for _, size := range []int{1, workers} {
+		b.Run(fmt.Sprintf("buffer=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				p := New(WithMaxConcurrency(workers), WithResultsBuffer(size))
+				p.RunN(10*workers, func() error { return nil })
+				p.Wait()
+			}
+		})
+	}
+}
+
+func TestWithResultTransform(t *testing.T) {
+	errFailed := errors.New("failed")
+	p := New(
+		WithResultTransform(func(r TaskResult) TaskResult {
+			if r.Err != nil {
+				r.Err = fmt.Errorf("enriched: %w", r.Err)
+			}
+			return r
+		}),
+		// runs second, so it sees the enriched error
+		WithResultTransform(func(r TaskResult) TaskResult {
+			if errors.Is(r.Err, io.EOF) {
+				r.Success, r.Err = true, nil
+			}
+			return r
+		}),
+	)
+	failed := p.Run(func() error { return errFailed })
+	eof := p.Run(func() error { return io.EOF })
+	ok := p.Run(func() error { return nil })
+	results := p.WaitMap()
+
+	if r := results[failed]; r.Success || r.Err == nil || r.Err.Error() != "enriched: failed" || !errors.Is(r.Err, errFailed) {
+		t.Errorf("failed task: got %+v, want the enriched error", r)
+	}
+	for _, id := range []uint64{eof, ok} {
+		if r := results[id]; !r.Success || r.Err != nil {
+			t.Errorf("task %d: got %+v, want a success", id, r)
+		}
+	}
+	if s := p.Stats(); s.Completed != 2 || s.Failed != 1 {
+		t.Errorf("Stats() = %d completed, %d failed, want the transformed outcomes 2 and 1", s.Completed, s.Failed)
+	}
+}
+
+func TestDispatchModes(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		// workers move on while the consumer is busy
+		nonBlocking bool
+	}{
+		{"sync", []Option{WithSyncDispatch()}, false},
+		{"async", []Option{WithAsyncDispatch()}, true},
+		{"async undone", []Option{WithAsyncDispatch(), WithSyncDispatch()}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const workers, tasks = 4, 100
+			p := New(append(tt.opts, WithMaxConcurrency(workers), WithResultsBuffer(0))...)
+			var ran atomic.Int32
+			p.RunN(tasks, func() error { ran.Add(1); return nil })
+
+			// hold up the consumer on the first result and watch how
+			// many tasks run meanwhile
+			var results int
+			var ranWhileBusy int32
+			p.ForEachResult(func(TaskResult) {
+				results++
+				if results > 1 {
+					return
+				}
+				deadline := time.Now().Add(50 * time.Millisecond)
+				if tt.nonBlocking {
+					deadline = time.Now().Add(5 * time.Second)
+				}
+				for ran.Load() < tasks && time.Now().Before(deadline) {
+					time.Sleep(time.Millisecond)
+				}
+				ranWhileBusy = ran.Load()
+			})
+
+			if results != tasks {
+				t.Fatalf("got %d results, want %d", results, tasks)
+			}
+			if allRan := ranWhileBusy == tasks; allRan != tt.nonBlocking {
+				t.Errorf("%d of %d tasks ran while the consumer was busy", ranWhileBusy, tasks)
+			}
+		})
+	}
+}
+
+// BenchmarkDispatch collects 10,000 short tasks through each dispatch
+// mode.
+func BenchmarkDispatch(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		opt  Option
+	}{
+		{"sync", WithSyncDispatch()},
+		{"async", WithAsyncDispatch()},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				p := New(WithMaxConcurrency(runtime.GOMAXPROCS(0)), tc.opt)
+				p.RunN(10_000, func() error { return nil })
+				p.Wait()
+			}
+		})
+	}
+}
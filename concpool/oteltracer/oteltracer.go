@@ -0,0 +1,75 @@
+// Package oteltracer adapts an OpenTelemetry trace.Tracer to the
+// concpool.Tracer interface, so the spans a pool records with
+// concpool.WithTracing are exported through OpenTelemetry:
+//
+//	p := concpool.New(concpool.WithTracing(oteltracer.New(otel.Tracer("my-service"))))
+//
+// It lives in a package of its own so that concpool itself doesn't depend
+// on OpenTelemetry.
+package oteltracer
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/almoatamed/go-conc/concpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// New returns a concpool.Tracer that starts its spans with tracer.
+func New(tracer trace.Tracer) concpool.Tracer {
+	return otelTracer{tracer}
+}
+
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+func (t otelTracer) StartSpan(ctx context.Context, name string) (context.Context, concpool.Span) {
+	ctx, span := t.tracer.Start(ctx, name)
+	return ctx, otelSpan{span}
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s otelSpan) SetAttribute(key string, value any) {
+	s.span.SetAttributes(keyValue(key, value))
+}
+
+// RecordError records err as an event on the span and marks the span as
+// failed.
+func (s otelSpan) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s otelSpan) End() {
+	s.span.End()
+}
+
+// keyValue converts an attribute value given to concpool.Span to the
+// closest OpenTelemetry type, falling back to its string form.
+func keyValue(key string, value any) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case uint64:
+		if v <= math.MaxInt64 {
+			return attribute.Int64(key, int64(v))
+		}
+	case float64:
+		return attribute.Float64(key, v)
+	}
+	return attribute.String(key, fmt.Sprint(value))
+}
@@ -0,0 +1,98 @@
+package oteltracer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/almoatamed/go-conc/concpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := provider.Tracer("concpool-test")
+
+	p := concpool.New(concpool.WithMaxConcurrency(2), concpool.WithTracing(New(tracer)))
+	ctx, parent := tracer.Start(context.Background(), "request")
+
+	const sleep = 30 * time.Millisecond
+	errFailed := errors.New("downstream failed")
+	okID := p.ContextualRun(ctx, func(ctx context.Context) error {
+		_, child := tracer.Start(ctx, "downstream")
+		time.Sleep(sleep)
+		child.End()
+		return nil
+	})
+	failedID := p.ContextualRun(ctx, func(context.Context) error { return errFailed })
+	p.Wait()
+	parent.End()
+
+	spans := map[string][]tracetest.SpanStub{}
+	for _, s := range exporter.GetSpans() {
+		spans[s.Name] = append(spans[s.Name], s)
+	}
+	if len(spans["request"]) != 1 || len(spans["concpool.task"]) != 2 || len(spans["downstream"]) != 1 {
+		t.Fatalf("exported spans = %v, want one request, two concpool.task and one downstream", exporter.GetSpans())
+	}
+	request, downstream := spans["request"][0], spans["downstream"][0]
+
+	tasks := map[int64]tracetest.SpanStub{}
+	for _, s := range spans["concpool.task"] {
+		if s.Parent.SpanID() != request.SpanContext.SpanID() {
+			t.Errorf("task span's parent is %v, want the request span", s.Parent.SpanID())
+		}
+		for _, kv := range s.Attributes {
+			if kv.Key == "task.id" {
+				tasks[kv.Value.AsInt64()] = s
+			}
+		}
+	}
+	ok, failed := tasks[int64(okID)], tasks[int64(failedID)]
+	if ok.Name == "" || failed.Name == "" {
+		t.Fatalf("task spans missing task.id attributes: %v", spans["concpool.task"])
+	}
+
+	if downstream.Parent.SpanID() != ok.SpanContext.SpanID() {
+		t.Errorf("downstream span's parent is %v, want its task's span", downstream.Parent.SpanID())
+	}
+	if d := ok.EndTime.Sub(ok.StartTime); d < sleep || d > sleep+20*time.Millisecond {
+		t.Errorf("task span lasted %v, want about %v", d, sleep)
+	}
+
+	if ok.Status.Code == codes.Error {
+		t.Errorf("successful task's span has status %v", ok.Status)
+	}
+	if failed.Status.Code != codes.Error || failed.Status.Description != errFailed.Error() {
+		t.Errorf("failed task's span has status %v, want an error", failed.Status)
+	}
+	if len(failed.Events) != 1 || failed.Events[0].Name != "exception" {
+		t.Errorf("failed task's span has events %v, want the recorded error", failed.Events)
+	}
+}
+
+func TestKeyValue(t *testing.T) {
+	tests := []struct {
+		value any
+		want  attribute.Value
+	}{
+		{"fetch", attribute.StringValue("fetch")},
+		{true, attribute.BoolValue(true)},
+		{3, attribute.IntValue(3)},
+		{int64(-4), attribute.Int64Value(-4)},
+		{uint64(5), attribute.Int64Value(5)},
+		{uint64(1 << 63), attribute.StringValue("9223372036854775808")},
+		{1.5, attribute.Float64Value(1.5)},
+		{time.Second, attribute.StringValue("1s")},
+	}
+	for _, tt := range tests {
+		if got := keyValue("k", tt.value); got.Value != tt.want {
+			t.Errorf("keyValue(%#v) = %v, want %v", tt.value, got.Value.Emit(), tt.want.Emit())
+		}
+	}
+}
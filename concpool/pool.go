@@ -1,67 +1,561 @@
 // Package concpool provides a small concurrent worker pool for running
 // functions of the form func() error. It is designed to be simple to use
 // and publish as a standalone package.
+//
+// # Migrating from New(maxCount)
+//
+// New used to take the concurrency limit as its only argument. It now takes
+// functional options so that new settings can be added without breaking
+// callers. Code that called New(n) can either switch to the options form
+//
+//	p := concpool.New(concpool.WithMaxConcurrency(n))
+//
+// or keep the old behaviour unchanged with NewSimple:
+//
+//	p := concpool.NewSimple(n)
 package concpool
 
 import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"runtime"
+	"runtime/debug"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // TaskResult represents the outcome of a single task executed by the pool.
 type TaskResult struct {
+	// ID is the identifier Run returned when the task was submitted.
+	ID uint64
+	// Index is the zero-based position of the task in submission order,
+	// which is always ID-1.
+	Index int
+	// Name is the label given to RunNamed, or empty.
+	Name string
+
 	Success bool
 	Err     error
+
+	// Cancelled is true when the task never ran, either because its
+	// context was done before a worker picked it up (Err holds the
+	// context's error) or because the pool was cancelled (Err is
+	// ErrCancelled).
+	Cancelled bool
+	// Expired is true, along with Cancelled, when a task submitted with
+	// RunWithTTL was still queued once its TTL ran out. Err is
+	// ErrTaskExpired.
+	Expired bool
+	// Skipped is true, along with Cancelled, for the tasks of a RunSerial
+	// chain that were never submitted because an earlier one failed or
+	// was cancelled (Err is ErrSkipped), and for RunAfterAll tasks whose
+	// dependencies did not all succeed (Err is ErrDependencyFailed).
+	Skipped bool
+
+	// StartedAt is when the task started running and Duration how long it
+	// ran, including any retries. Both are zero for tasks that never ran.
+	StartedAt time.Time
+	Duration  time.Duration
+
+	// Attempts is how many times the task was run: 1 unless it was
+	// submitted with retries, and 0 if it never ran.
+	Attempts int
+
+	// Deferred is set for tasks registered with Defer.
+	Deferred bool
+
+	// SubmissionStack holds the program counters of the goroutine that
+	// submitted the task, if the pool was created with WithSubmissionTrace.
+	// Use SubmissionFrames to resolve them.
+	SubmissionStack []uintptr
+
+	// Meta is the metadata given to RunWithMeta, or nil.
+	Meta map[string]string
+}
+
+// Slow reports whether the task ran for longer than threshold.
+func (r TaskResult) Slow(threshold time.Duration) bool {
+	return r.Duration > threshold
+}
+
+// counters are the cumulative task counters behind PoolStats.
+type counters struct {
+	submitted atomic.Uint64
+	started   atomic.Uint64
+	completed atomic.Uint64
+	failed    atomic.Uint64
+	cancelled atomic.Uint64
+}
+
+func (c *counters) reset() {
+	c.submitted.Store(0)
+	c.started.Store(0)
+	c.completed.Store(0)
+	c.failed.Store(0)
+	c.cancelled.Store(0)
+}
+
+// job is a queued unit of work together with the metadata the pool needs
+// to schedule it.
+type job struct {
+	id       uint64
+	fn       func() error
+	ctx      context.Context
+	timeout  time.Duration
+	retry    *RetryOptions
+	future   *Future
+	group    *TaskGroup
+	priority int
+	name     string
+	deferred bool
+	// probe marks the trial task of a half-open circuit breaker.
+	probe bool
+	// stack is the submission trace recorded with WithSubmissionTrace.
+	stack []uintptr
+	// expires is the deadline set by RunWithTTL for starting the job.
+	expires time.Time
+	// weight is the share of the concurrency limit the job occupies while
+	// it runs, set by RunWeighted; see cost.
+	weight int
+	// epoch is the AIMD epoch the job started in (see WithAIMD).
+	epoch uint64
+	// meta is the RunWithMeta metadata, copied at submission.
+	meta map[string]string
+	// serial holds the rest of a RunSerial chain, to be submitted once
+	// the job has succeeded.
+	serial []func() error
+
+	// settled is set once a result has been reported for the job, so a
+	// worker that outlives a Shutdown deadline does not report it twice.
+	settled atomic.Bool
+
+	// shared marks a RunConcurrent job, which its submitter may run itself
+	// while it is still queued; taken is set by whoever gets to it first
+	// (see take).
+	shared bool
+	taken  atomic.Bool
+
+	// waitGroups are the Pool.WaitGroup adapters waiting for the job's
+	// result. mu guards them and resolved, which is set by settle.
+	mu         sync.Mutex
+	waitGroups []*sync.WaitGroup
+	resolved   bool
+}
+
+// index returns the job's zero-based submission index.
+func (t *job) index() int {
+	return int(t.id - 1)
+}
+
+// cost returns how many units of the concurrency limit t occupies.
+func (t *job) cost() int {
+	if t.weight < 1 {
+		return 1
+	}
+	return t.weight
+}
+
+// take claims t for starting or dropping and reports whether the caller
+// got it. Only a shared job can be claimed twice, by a worker and by its
+// submitter, and only one of them gets it.
+func (t *job) take() bool {
+	return !t.shared || t.taken.CompareAndSwap(false, true)
+}
+
+// settle hands r to the job's Future and TaskGroup, if it has them, and
+// tells any WaitGroup adapters the job is done.
+func (t *job) settle(r TaskResult) {
+	if t.future != nil {
+		t.future.resolve(r)
+	}
+	if t.group != nil {
+		t.group.add(r)
+	}
+
+	t.mu.Lock()
+	waitGroups := t.waitGroups
+	t.waitGroups = nil
+	t.resolved = true
+	t.mu.Unlock()
+	for _, wg := range waitGroups {
+		wg.Done()
+	}
+}
+
+// addWaitGroup makes settle call wg.Done, after adding one to wg, unless
+// the job already has its result.
+func (t *job) addWaitGroup(wg *sync.WaitGroup) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.resolved {
+		wg.Add(1)
+		t.waitGroups = append(t.waitGroups, wg)
+	}
 }
 
 // Pool runs up to maxCount tasks concurrently. Use New to create a pool,
 // Run to submit tasks, and Wait to block until all submitted work is done.
+//
+// The zero value is ready to use, so a Pool can be declared as a variable
+// or embedded in a struct without calling New. It behaves like New() but
+// runs up to runtime.GOMAXPROCS(0) tasks at once; SetMaxConcurrency can
+// change that. A Pool must not be copied after first use.
 type Pool struct {
+	// initOnce guards setup, which New runs straight away and lazyInit
+	// runs for zero-value pools.
+	initOnce sync.Once
+
 	maxCount int
-	queue    []func() error
+	queue    jobQueue
 	running  int
 	results  chan TaskResult
+	// lastID is the ID handed to the most recently submitted task.
+	lastID atomic.Uint64
+
+	// counts holds the cumulative counters reported by Stats.
+	counts counters
+	// earlier holds what counts had reached before the last Reset, for
+	// TotalSubmitted and friends. It is guarded by mu.
+	earlier struct{ submitted, completed, failed uint64 }
+	// goroutines is the number of goroutines started by spawn that are
+	// still running.
+	goroutines atomic.Int64
+
+	// dropped holds results produced without running a task (for example
+	// cancelled queue entries); the Wait loop drains it.
+	dropped []TaskResult
 
 	mu sync.Mutex
 
-	terminated         bool
-	terminationChannel chan bool
-	runCheckChannel    chan bool
+	terminated bool
+	// runCheckChannel wakes the event loop when there may be something new
+	// for it: a finished task, a dropped one, or a pool that went idle.
+	runCheckChannel chan bool
+
+	// workers is the current set of worker goroutines, started on demand.
+	workers *workerSet
+
+	// slotFreed is signalled, with mu, whenever running drops or maxCount
+	// rises, for Semaphore callers waiting for a slot. semHeld is the
+	// number of slots they hold.
+	slotFreed *sync.Cond
+	semHeld   int
+
+	// cancelled is set by Cancel; done is closed at the same time so
+	// tasks submitted with RunCancellable can stop early.
+	cancelled bool
+	done      chan struct{}
+
+	// paused stops checkQueue from starting new tasks.
+	paused bool
+
+	// dispatching counts the results still being handed over by
+	// WithAsyncDispatch goroutines; the pool doesn't terminate before
+	// they have all arrived.
+	dispatching int
+
+	// inflight holds the jobs currently running, keyed by ID.
+	inflight map[uint64]*job
+
+	// shuttingDown is set by Shutdown and makes further submissions panic.
+	// abandoned is closed when a Shutdown deadline passes or WaitFirstN has
+	// what it needs, releasing any worker still trying to hand over a
+	// result nobody will collect.
+	shuttingDown bool
+	abandoned    chan struct{}
+
+	// late holds the RunAfter tasks that came due after the pool had
+	// terminated; Reset submits them to the next batch.
+	late []*ScheduledTask
+
+	// stream is the channel handed out by Results, if it has been called.
+	stream chan TaskResult
+
+	// settings from Options
+	failFast         bool
+	cancelledAsError bool
+	maxFailures      int
+	maxQueue         int
+	queueCapacity    int
+	overflow         overflowPolicy
+	usePriority      bool
+	userQueue        Queue
+	lifo             bool
+	recoverPanics    bool
+	panicHandler     func(recovered interface{}) error
+	submissionTrace  bool
+	transforms       []func(TaskResult) TaskResult
+	journalOn        bool
+	retry            *RetryOptions
+	resultsBuffer    int
+	sinkBuffer       int
+	idleTimeout      time.Duration
+	minWorkers       int
+	asyncDispatch    bool
+	runCheckBuffer   int
+
+	// tracer records task spans for pools created with WithTracing.
+	tracer Tracer
+
+	// aimd adjusts maxCount for pools created with WithAIMD.
+	aimd *aimd
+
+	// scaler adjusts maxCount for pools created with NewAutoScaling.
+	scaler *scaler
+	// limiter paces task starts for pools created with NewRateLimited.
+	limiter *tokenBucket
+	burst   int
+	// breaker is set by WithCircuitBreaker.
+	breaker         *circuitBreaker
+	circuitCooldown time.Duration
+
+	// name is set by WithName; logger is set by WithLogger.
+	name   string
+	logger *slog.Logger
+
+	// middleware wraps every task; see Use.
+	middleware []Middleware
+
+	// feeders is the number of RunFromChannel and RunIterator goroutines
+	// still reading tasks, plus the Holds not yet released and the
+	// submitters waiting in waitForRoom; the pool doesn't terminate while
+	// there are any.
+	feeders int
+
+	// deferred holds the tasks registered with Defer that haven't been
+	// queued yet, in registration order.
+	deferred []*job
+
+	// space is closed, and reset to nil, whenever a task leaves the queue,
+	// waking RunBounded callers waiting for room. It is created on demand.
+	space chan struct{}
+
+	// onComplete and onError are the callbacks registered with OnComplete
+	// and OnError.
+	onComplete func(TaskResult)
+	onError    func(TaskResult)
+	onDiscard  func(n int)
+
+	// onResultBlocking is the callback registered with OnResultBlocking,
+	// run by sink. sinkPending counts the results handed to sink that fn
+	// hasn't returned from yet; the pool doesn't terminate before it is
+	// zero.
+	onResultBlocking func(TaskResult)
+	sink             *resultSink
+	sinkPending      int
+
+	// onIdle is the callback registered with OnIdle. idleArmed is set while
+	// it is waiting for the pool to go idle.
+	onIdle    func()
+	idleArmed bool
+
+	// observer is the TestObserver handed out by TestObserver, if any.
+	observer atomic.Pointer[TestObserver]
+
+	// journal holds the entries recorded with WithWorkJournal.
+	journal []JournalEntry
+
+	// subscribers are the observers registered with Subscribe. The slice
+	// is replaced rather than modified, so workers can range over a copy
+	// of it without holding the lock.
+	subscribers []*subscriber
+}
+
+// New creates a new Pool configured by opts. Without options the pool runs
+// one task at a time, has an unbounded queue and recovers task panics; use
+// WithMaxConcurrency to allow more tasks to run at once.
+func New(opts ...Option) *Pool {
+	p := &Pool{}
+	p.initOnce.Do(func() { p.setup(1, opts) })
+	if p.minWorkers > 0 {
+		p.Prewarm(p.minWorkers)
+	}
+	return p
+}
+
+// lazyInit sets up a zero-value Pool the first time it is used. Pools made
+// by New are set up already. It must be called without p.mu held.
+func (p *Pool) lazyInit() {
+	p.initOnce.Do(func() { p.setup(runtime.GOMAXPROCS(0), nil) })
+}
+
+// setup applies the defaults, with maxCount as the concurrency limit, and
+// then opts, and creates the pool's channels and queue.
+func (p *Pool) setup(maxCount int, opts []Option) {
+	p.maxCount = maxCount
+	p.resultsBuffer = -1
+	p.sinkBuffer = defaultResultCallbackBuffer
+	p.runCheckBuffer = 1
+	p.recoverPanics = true
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.aimd != nil {
+		if p.maxCount < p.aimd.min || p.maxCount > p.aimd.max {
+			p.maxCount = p.aimd.min
+		}
+		p.aimd.history = []int{p.maxCount}
+	}
+	if p.resultsBuffer < 0 {
+		p.resultsBuffer = p.maxCount
+	}
+	if p.breaker != nil && p.circuitCooldown > 0 {
+		p.breaker.cooldown = p.circuitCooldown
+	}
+	if p.logger != nil {
+		p.logger = p.logger.With("pool", p.Name())
+	}
+
+	switch {
+	case p.userQueue != nil:
+		p.queue = newExternalQueue(p.userQueue)
+		if c, ok := p.userQueue.(interface{ Cap() int }); ok && (p.maxQueue == 0 || p.maxQueue > c.Cap()) {
+			p.maxQueue = c.Cap()
+		}
+	case p.usePriority:
+		p.queue = &priorityQueue{}
+	default:
+		capacity := p.maxCount * 2
+		if p.queueCapacity > 0 {
+			capacity = p.queueCapacity
+			if p.overflow != overflowGrow && (p.maxQueue == 0 || p.maxQueue > capacity) {
+				p.maxQueue = capacity
+			}
+		}
+		p.queue = newRingBuffer[*job](capacity, p.lifo)
+	}
+	p.results = make(chan TaskResult, p.resultsBuffer)
+	p.runCheckChannel = make(chan bool, p.runCheckBuffer)
+	p.done = make(chan struct{})
+	p.inflight = make(map[uint64]*job)
+	p.slotFreed = sync.NewCond(&p.mu)
+	p.abandoned = make(chan struct{})
+}
+
+// NewSimple creates a new Pool that will run up to maxCount tasks
+// concurrently. It is equivalent to New(WithMaxConcurrency(maxCount)) and
+// keeps the original New signature available.
+func NewSimple(maxCount int) *Pool {
+	return New(WithMaxConcurrency(maxCount))
+}
+
+// NewWeighted creates a Pool for tasks submitted with RunWeighted, whose
+// total weight running at once is limited to maxWeight (at least 1). When
+// capacity is short it starts the lightest queued tasks first, and tasks of
+// equal weight in submission order; tasks submitted with Run weigh 1. A
+// steady stream of light tasks can therefore hold back a heavy one.
+func NewWeighted(maxWeight int) *Pool {
+	p := NewSimple(maxWeight)
+	p.queue = &priorityQueue{jobs: jobHeap{order: lighter}}
+	return p
+}
+
+// NewDefault creates a Pool sized for CPU-bound work: it runs up to
+// runtime.GOMAXPROCS(0) tasks at once, one per processor the Go scheduler
+// uses. More than that only adds contention for tasks that never block.
+func NewDefault() *Pool {
+	return NewSimple(runtime.GOMAXPROCS(0))
+}
+
+// NewDefaultIO creates a Pool sized for I/O-bound work, running up to
+// runtime.GOMAXPROCS(0) * multiplier tasks at once. Tasks that spend most
+// of their time waiting on the network or disk leave the processors idle,
+// so a pool can usefully run many more of them than there are processors;
+// multipliers between 10 and 100 are typical. A multiplier below 1 is
+// treated as 1.
+func NewDefaultIO(multiplier int) *Pool {
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	return NewSimple(runtime.GOMAXPROCS(0) * multiplier)
 }
 
-// New creates a new Pool that will run up to maxCount tasks concurrently.
-func New(maxCount int) *Pool {
-	if maxCount <= 0 {
-		maxCount = 1
+func (p *Pool) pushToQueue(jobs ...*job) {
+	var queued []*job
+	var depths []int
+	p.mu.Lock()
+	for _, t := range jobs {
+		if p.overflow == overflowBlock {
+			p.waitForRoom()
+		}
+		if p.enqueue(t) && p.observed() {
+			queued = append(queued, t)
+			depths = append(depths, p.queue.len())
+		}
+	}
+	p.mu.Unlock()
+
+	for i, t := range queued {
+		p.logSubmitted(t, depths[i])
 	}
+}
 
-	return &Pool{
-		maxCount:           maxCount,
-		queue:              make([]func() error, 0, maxCount*2),
-		results:            make(chan TaskResult, 1),
-		terminationChannel: make(chan bool, 1),
-		runCheckChannel:    make(chan bool, 1),
+// enqueue queues t, or drops it with ErrQueueFull if the queue is full,
+// and reports whether it was queued. The caller must hold p.mu.
+func (p *Pool) enqueue(t *job) bool {
+	if p.maxQueue > 0 && p.queue.len() >= p.maxQueue {
+		p.drop(t, ErrQueueFull)
+		return false
 	}
+	p.queue.push(t)
+	return true
 }
 
-func (p *Pool) pushToQueue(task func() error) {
+func (p *Pool) takeDropped() []TaskResult {
 	p.mu.Lock()
-	p.queue = append(p.queue, task)
+	dropped := p.dropped
+	p.dropped = nil
 	p.mu.Unlock()
+	return dropped
 }
 
-func (p *Pool) attemptTermination() {
+// attemptTermination marks the pool terminated if it has nothing left to
+// do and reports whether it is terminated. Only the event loop calls it:
+// a pool that isn't being waited on just sits idle.
+func (p *Pool) attemptTermination() bool {
 	p.mu.Lock()
 	if p.terminated {
 		p.mu.Unlock()
-		return
+		return true
 	}
-	p.terminated = true
-	// non-blocking send so callers don't deadlock if Wait isn't yet listening
-	select {
-	case p.terminationChannel <- true:
-	default:
+	if p.queue.len() > 0 || p.running > 0 || p.feeders > 0 || p.dispatching > 0 || p.sinkPending > 0 {
+		p.mu.Unlock()
+		return false
+	}
+	// run the deferred tasks one by one, last registered first, before
+	// the pool counts as done
+	if n := len(p.deferred); n > 0 {
+		t := p.deferred[n-1]
+		p.deferred = p.deferred[:n-1]
+		p.queue.push(t)
+		p.mu.Unlock()
+		p.attemptCheck()
+		return false
 	}
+	p.terminated = true
+	p.stopWorkers()
 	p.mu.Unlock()
+
+	if p.logger != nil {
+		p.logTerminated()
+	}
+	return true
+}
+
+// spawn runs fn on a new goroutine, counted in Stats until it returns.
+func (p *Pool) spawn(fn func()) {
+	p.goroutines.Add(1)
+	go func() {
+		defer p.goroutines.Add(-1)
+		fn()
+	}()
 }
 
 func (p *Pool) attemptCheck() {
@@ -72,79 +566,1673 @@ func (p *Pool) attemptCheck() {
 	}
 }
 
+// checkQueue starts as many queued tasks as the concurrency limit allows.
 func (p *Pool) checkQueue() {
 	p.mu.Lock()
-	if p.terminated {
-		p.mu.Unlock()
-		return
+	var start []*job
+	for {
+		t := p.next()
+		if t == nil {
+			break
+		}
+		start = append(start, t)
 	}
+	// the queue may have held nothing but dropped tasks
+	onIdle := p.takeIdleCallback()
+	p.mu.Unlock()
 
-	available := p.maxCount - p.running
-	if available <= 0 {
-		p.mu.Unlock()
-		return
+	p.dispatch(start)
+	if onIdle != nil {
+		onIdle()
 	}
+}
 
-	for i := 0; i < available; i++ {
-		if len(p.queue) == 0 {
-			if p.running == 0 {
-				p.mu.Unlock()
-				p.attemptTermination()
-				return
+// next takes the next task that may start from the queue and counts it as
+// running, or returns nil if none may start right now. Queued tasks that
+// were cancelled in the meantime are dropped on the way. The caller must
+// hold p.mu.
+func (p *Pool) next() *job {
+	if p.terminated || p.paused {
+		return nil
+	}
+
+	for p.queue.len() > 0 {
+		// the next task needs room for its weight; one heavier than the
+		// whole pool runs on its own
+		if w := p.queue.peek().cost(); p.running > 0 && p.running+w > p.maxCount {
+			return nil
+		}
+
+		// an open circuit holds tasks back; cancelled ones are still
+		// dropped
+		if p.breaker != nil && p.breaker.blocked() && !p.cancelled {
+			return nil
+		}
+
+		// a rate-limited pool needs a token for every task it starts
+		if p.limiter != nil && !p.cancelled {
+			now := time.Now()
+			if !p.limiter.take(now) {
+				p.waitForToken(now)
+				return nil
 			}
-			p.mu.Unlock()
-			return
 		}
 
-		task := p.queue[0]
-		p.queue = p.queue[1:]
+		t := p.queue.pop()
+		p.signalSpace()
+
+		// tasks submitted after Cancel never run, apart from deferred ones
+		if p.cancelled && !t.deferred {
+			p.drop(t, ErrCancelled)
+			continue
+		}
+
+		// drop tasks whose context finished while they were queued; they
+		// don't take up a worker slot
+		if t.ctx != nil && t.ctx.Err() != nil {
+			p.drop(t, t.ctx.Err())
+			if p.limiter != nil {
+				p.limiter.refund()
+			}
+			continue
+		}
 
-		p.running++
+		// likewise for tasks that outlived their TTL
+		if !t.expires.IsZero() && time.Now().After(t.expires) {
+			p.drop(t, ErrTaskExpired)
+			if p.limiter != nil {
+				p.limiter.refund()
+			}
+			continue
+		}
 
-		// run task in its own goroutine
-		go func(t func() error) {
-			err := t()
-			if err != nil {
-				p.results <- TaskResult{Success: false, Err: err}
-			} else {
-				p.results <- TaskResult{Success: true, Err: nil}
+		// RunConcurrent's caller may have run it already
+		if !t.take() {
+			if p.limiter != nil {
+				p.limiter.refund()
 			}
+			continue
+		}
+
+		if p.breaker != nil {
+			p.breaker.admit(t)
+		}
+		if p.aimd != nil {
+			t.epoch = p.aimd.epoch
+		}
+		p.running += t.cost()
+		p.inflight[t.id] = t
+		p.counts.started.Add(1)
+		return t
+	}
+	return nil
+}
+
+// execute runs t on the calling goroutine and reports its result.
+func (p *Pool) execute(t *job) {
+	if p.observed() {
+		p.mu.Lock()
+		running := p.running
+		p.mu.Unlock()
+		p.logStarted(t, running)
+	}
+
+	startedAt := time.Now()
+	attempts, err := p.runJob(t)
+	r := TaskResult{
+		ID:        t.id,
+		Index:     t.index(),
+		Name:      t.name,
+		Success:   err == nil,
+		Err:       err,
+		StartedAt: startedAt,
+		Duration:  time.Since(startedAt),
+		Attempts:  attempts,
+		Deferred:  t.deferred,
+
+		SubmissionStack: t.stack,
+		Meta:            t.meta,
+	}
 
+	// Shutdown may already have reported this job as timed out
+	if !t.settled.CompareAndSwap(false, true) {
+		return
+	}
+
+	for _, fn := range p.transforms {
+		r = fn(r)
+	}
+	if p.journalOn {
+		p.recordJournal(r)
+	}
+
+	p.recordOutcome(t, !r.Success)
+	p.adjustConcurrency(t, !r.Success)
+
+	if !r.Success {
+		failures := p.counts.failed.Add(1)
+		if p.maxFailures > 0 && failures == uint64(p.maxFailures) {
 			p.mu.Lock()
-			p.running--
+			p.dropped = append(p.dropped, TaskResult{Index: -1, Err: ErrMaxFailuresExceeded})
 			p.mu.Unlock()
+			p.Cancel()
+		}
+		if p.failFast {
+			p.Cancel()
+		}
+	} else {
+		p.counts.completed.Add(1)
+	}
 
-			// ask the loop to check if more work can be started
-			p.attemptCheck()
-		}(task)
+	if p.observed() {
+		p.logFinished(r)
+	}
+
+	p.mu.Lock()
+	onComplete, onError, subscribers := p.onComplete, p.onError, p.subscribers
+	var sink *resultSink
+	if p.onResultBlocking != nil {
+		sink = p.resultSink()
+		p.sinkPending++
+	}
+	p.mu.Unlock()
+	if onComplete != nil {
+		onComplete(r)
+	}
+	if onError != nil && !r.Success {
+		onError(r)
+	}
+	for _, s := range subscribers {
+		s.push(r)
+	}
+	if sink != nil {
+		p.sinkResult(sink, r)
+	}
+	t.settle(r)
+	if len(t.serial) > 0 {
+		p.continueSerial(t, r.Success)
+	}
+	// group results are only reported to the group
+	if t.group != nil {
+		return
 	}
 
+	p.mu.Lock()
+	results, abandoned := p.results, p.abandoned
+	async := p.asyncDispatch
+	if async {
+		p.dispatching++
+	}
 	p.mu.Unlock()
+
+	if !async {
+		deliver(results, abandoned, r)
+		return
+	}
+	p.spawn(func() {
+		deliver(results, abandoned, r)
+		p.mu.Lock()
+		p.dispatching--
+		p.mu.Unlock()
+		p.attemptCheck()
+	})
+}
+
+// deliver sends r on results, unless nobody is going to collect it any
+// more.
+func deliver(results chan<- TaskResult, abandoned <-chan struct{}, r TaskResult) {
+	select {
+	case <-abandoned:
+		return
+	default:
+	}
+
+	select {
+	case results <- r:
+	case <-abandoned:
+	}
+}
+
+// runJob calls the task, retrying it if it was submitted with retry
+// options, and returns the number of attempts along with the last error.
+func (p *Pool) runJob(t *job) (int, error) {
+	err := p.callJob(t)
+	attempts := 1
+
+	retry := t.retry
+	if retry == nil {
+		retry = p.retry
+	}
+	if retry == nil {
+		return attempts, err
+	}
+
+	done := p.done
+	for err != nil && attempts < retry.MaxAttempts {
+		timer := time.NewTimer(retry.delay(attempts))
+		select {
+		case <-timer.C:
+		case <-done:
+			timer.Stop()
+			return attempts, err
+		}
+		attempts++
+		err = p.callJob(t)
+	}
+
+	// say which task gave up; panics already carry the name
+	var pe *PanicError
+	if err != nil && attempts > 1 && t.name != "" && !errors.As(err, &pe) {
+		err = fmt.Errorf("task %q: %w", t.name, err)
+	}
+	return attempts, err
+}
+
+// callJob calls the task once, enforcing its timeout if it has one. A task
+// that times out keeps running in its own goroutine; its eventual result is
+// discarded.
+func (p *Pool) callJob(t *job) error {
+	if t.timeout <= 0 {
+		return p.callTask(t)
+	}
+
+	done := make(chan error, 1)
+	p.spawn(func() {
+		done <- p.callTask(t)
+	})
+
+	timer := time.NewTimer(t.timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return ErrTimeout
+	}
+}
+
+// drop records t as cancelled without running it. The caller must hold
+// p.mu.
+func (p *Pool) drop(t *job, err error) {
+	// RunConcurrent's caller reports the jobs it ran
+	if !t.take() {
+		return
+	}
+	r := TaskResult{ID: t.id, Index: t.index(), Name: t.name, Success: false, Err: err, Cancelled: true, Expired: err == ErrTaskExpired, Deferred: t.deferred, SubmissionStack: t.stack, Meta: t.meta}
+	p.counts.cancelled.Add(1)
+	if t.group == nil {
+		p.dropped = append(p.dropped, r)
+	}
+	t.settle(r)
+	p.skip(t.serial)
+}
+
+// callTask runs the task through the middleware and, unless panic recovery
+// was turned off, converts a panic into a *PanicError so a misbehaving task
+// can't take the whole program down.
+func (p *Pool) callTask(t *job) (err error) {
+	fn := p.wrap(t.fn)
+	if !p.recoverPanics {
+		return fn()
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			err = p.panicError(t, v, debug.Stack())
+		}
+	}()
+	return fn()
+}
+
+// panicError returns the error to report for a task that panicked with v:
+// whatever the WithPanicHandler handler makes of it, or a *PanicError. A
+// handler that panics itself gets the *PanicError too.
+func (p *Pool) panicError(t *job, v any, stack []byte) (err error) {
+	fallback := &PanicError{Pool: p.name, Name: t.name, Value: v, Stack: stack}
+	if p.panicHandler == nil {
+		return fallback
+	}
+
+	defer func() {
+		if recover() != nil {
+			err = fallback
+		}
+	}()
+	return p.panicHandler(v)
 }
 
 // Run submits a task to the pool. The task must be func() error.
-// Tasks are executed in FIFO order as workers become available.
-func (p *Pool) Run(task func() error) {
-	p.pushToQueue(task)
+// Tasks are executed in FIFO order as workers become available. If the
+// queue is bounded (WithMaxQueue) and full, the task is not queued; it is
+// reported with Cancelled set and Err set to ErrQueueFull.
+//
+// Run returns the ID that will be reported in the task's TaskResult. IDs
+// start at 1 and increase by one with every submission, so they can be used
+// to match results back to the tasks that produced them.
+//
+// Tasks may call Run on their own pool to submit follow-up work, to any
+// depth: a task is still running while it submits, so the pool can't
+// terminate in between, and Wait covers the new tasks too. Unless the pool
+// was created with WithOverflowBlock, Run never blocks, so a full queue
+// rejects such tasks rather than deadlocking the pool; the same isn't true
+// of RunBounded, which inside a task may wait for room that only the tasks
+// blocked alongside it could make. A task that leaves submitting to
+// another goroutine should Hold the pool first.
+func (p *Pool) Run(task func() error) uint64 {
+	return p.submit(&job{fn: task})
+}
+
+// RunWithMeta is like Run but attaches meta to the task, such as a request
+// or trace ID captured at submission time. meta is copied, so the caller
+// may reuse it, and reported as Meta in the task's TaskResult and with the
+// task's log messages if the pool has a logger.
+func (p *Pool) RunWithMeta(meta map[string]string, task func() error) uint64 {
+	return p.submit(&job{fn: task, meta: maps.Clone(meta)})
+}
+
+// RunIf submits task like Run if cond is true, and otherwise does nothing
+// and returns 0, which is never a task ID. A task that isn't submitted
+// doesn't count towards the pool's tasks at all: it takes no ID and
+// produces no result, so Wait and the IDs of other tasks are unaffected.
+func (p *Pool) RunIf(cond bool, task func() error) uint64 {
+	if !cond {
+		return 0
+	}
+	return p.submit(&job{fn: task})
+}
+
+// RunUnless is RunIf with cond inverted: it submits task only if cond is
+// false.
+func (p *Pool) RunUnless(cond bool, task func() error) uint64 {
+	if cond {
+		return 0
+	}
+	return p.submit(&job{fn: task})
+}
+
+// RunAll submits every task in tasks, in order. It takes the pool lock and
+// wakes the event loop once for the whole slice, which makes it cheaper
+// than calling Run in a loop for large batches.
+func (p *Pool) RunAll(tasks []func() error) {
+	p.checkAccepting()
+	stack := p.captureStack(1)
+	jobs := make([]*job, len(tasks))
+	for i, task := range tasks {
+		jobs[i] = &job{id: p.lastID.Add(1), fn: task, stack: stack}
+	}
+	p.counts.submitted.Add(uint64(len(jobs)))
+	p.pushToQueue(jobs...)
 	p.attemptCheck()
 }
 
-// Wait blocks until all submitted tasks have finished and returns the
-// slice of TaskResult values in the order they completed.
-func (p *Pool) Wait() []TaskResult {
-	// start any available work
-	p.checkQueue()
+// RunMany is the variadic form of RunAll.
+func (p *Pool) RunMany(tasks ...func() error) {
+	p.RunAll(tasks)
+}
 
-	results := make([]TaskResult, 0)
+// RunN submits task n times, as one batch like RunAll. Every copy is a
+// separate call of task with its own TaskResult, but they all share the
+// same closure: variables it captures are shared between the copies, so
+// any state it modifies must be safe for concurrent use.
+func (p *Pool) RunN(n int, task func() error) {
+	tasks := make([]func() error, n)
+	for i := range tasks {
+		tasks[i] = task
+	}
+	p.RunAll(tasks)
+}
 
-	for {
-		select {
-		case <-p.runCheckChannel:
-			p.checkQueue()
-		case r := <-p.results:
-			results = append(results, r)
-		case <-p.terminationChannel:
-			return results
+// RunWithContext submits a task bound to ctx. If ctx is done before a worker
+// picks the task up, the task is dropped and reported as a TaskResult with
+// Cancelled set. A task that has already started is allowed to finish; the
+// pool cannot preempt it. With WithTracing the task runs in a span; use
+// ContextualRun to hand the span's context to the task.
+func (p *Pool) RunWithContext(ctx context.Context, task func() error) uint64 {
+	t := &job{fn: task, ctx: ctx}
+	if p.tracer != nil {
+		t.fn = func() error {
+			return p.runTraced(t, func(context.Context) error { return task() })
+		}
+	}
+	return p.submit(t)
+}
+
+// RunNamed is like Run but labels the task with name. The name is reported
+// in TaskResult.Name and included in the errors the pool builds for the
+// task, such as a *PanicError or the final error after retries.
+func (p *Pool) RunNamed(name string, task func() error) uint64 {
+	return p.submit(&job{fn: task, name: name})
+}
+
+// RunWithPriority submits a task with the given priority. When the pool was
+// created with WithPriorityQueue, queued tasks with a higher priority start
+// before those with a lower one, and tasks of equal priority start in
+// submission order. Run is equivalent to a priority of 0. Without
+// WithPriorityQueue the priority is ignored and tasks start in FIFO order.
+func (p *Pool) RunWithPriority(priority int, task func() error) uint64 {
+	return p.submit(&job{fn: task, priority: priority})
+}
+
+// RunWithTimeout submits a task that is reported as failed with ErrTimeout
+// if it runs longer than d. Go offers no way to stop a goroutine, so the
+// task itself keeps running in the background; the pool simply stops
+// counting it against the concurrency limit and ignores its result.
+func (p *Pool) RunWithTimeout(d time.Duration, task func() error) uint64 {
+	return p.submit(&job{fn: task, timeout: d})
+}
+
+// RunWeighted submits a task that occupies weight units of the pool's
+// concurrency limit while it runs, for tasks that use more resources
+// (memory, file descriptors) than others: a task of weight 3 counts as
+// three running tasks, and other tasks only start while their weight fits
+// in what is left. Weights below 1 are treated as 1, and a task heavier
+// than the whole limit runs on its own. Tasks still start in queue order,
+// so a heavy task at the front makes lighter ones behind it wait; use
+// NewWeighted for a pool that starts the lightest tasks first.
+func (p *Pool) RunWeighted(weight int, task func() error) uint64 {
+	return p.submit(&job{fn: task, weight: weight})
+}
+
+// RunWithTTL submits a task that is only worth running if it starts within
+// ttl of being submitted. If it is still queued after that, it is dropped
+// and reported with Expired and Cancelled set and Err set to
+// ErrTaskExpired. Once started it runs to completion like any other task.
+func (p *Pool) RunWithTTL(ttl time.Duration, task func() error) uint64 {
+	return p.submit(&job{fn: task, expires: time.Now().Add(ttl)})
+}
+
+// RunCancellable submits a task that receives a channel which is closed
+// when the pool is cancelled. Long-running tasks can select on it to return
+// early. Tasks submitted with Run or RunWithContext never see this signal.
+func (p *Pool) RunCancellable(task func(done <-chan struct{}) error) uint64 {
+	return p.submit(&job{fn: func() error {
+		// read when the task starts, since a zero-value pool only has
+		// its channel once submit has set it up
+		p.mu.Lock()
+		done := p.done
+		p.mu.Unlock()
+		return task(done)
+	}})
+}
+
+// Cancel stops the pool: every task still in the queue is dropped and
+// reported with Cancelled set and Err set to ErrCancelled, and the done
+// channel handed to RunCancellable tasks is closed. Tasks that are already
+// running are not interrupted, and Wait returns once they have finished.
+// Tasks submitted after Cancel are dropped the same way.
+//
+// Cancel is safe to call from any goroutine, including while Wait is
+// blocked, and calling it more than once has no further effect.
+func (p *Pool) Cancel() {
+	p.lazyInit()
+	p.mu.Lock()
+	if p.cancelled {
+		p.mu.Unlock()
+		return
+	}
+	p.cancelled = true
+	for _, t := range p.queue.clear() {
+		p.drop(t, ErrCancelled)
+	}
+	p.signalSpace()
+	close(p.done)
+	onIdle := p.takeIdleCallback()
+	p.mu.Unlock()
+
+	if onIdle != nil {
+		onIdle()
+	}
+
+	// wake the Wait loop so it collects the dropped tasks
+	p.attemptCheck()
+}
+
+// SetMaxConcurrency changes how many tasks may run at once. Values below 1
+// are treated as 1. Raising the limit starts queued tasks right away;
+// lowering it never interrupts running tasks, the pool just doesn't start
+// new ones until enough of them have finished.
+func (p *Pool) SetMaxConcurrency(n int) {
+	p.lazyInit()
+	if n <= 0 {
+		n = 1
+	}
+
+	p.mu.Lock()
+	p.maxCount = n
+	p.slotFreed.Broadcast()
+	p.mu.Unlock()
+
+	p.attemptCheck()
+}
+
+// SetQueue replaces the pool's queue with q, as if the pool had been
+// created with WithQueue(q), for example to switch from FIFO to priority
+// order when urgent work arrives. The tasks already queued are moved to q
+// in the order they were submitted. q must be empty and able to hold them
+// all; a capacity limit it has (see WithQueue) applies from then on.
+//
+// Swapping queues while tasks run would make the order they started in
+// depend on timing, so SetQueue returns an error instead if Running is not
+// zero: call it before waiting on the pool, or after pausing it and
+// letting the running tasks finish.
+func (p *Pool) SetQueue(q Queue) error {
+	p.lazyInit()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.running > 0 {
+		return errors.New("concpool: SetQueue called while tasks are running")
+	}
+	if q.Len() > 0 {
+		return errors.New("concpool: SetQueue needs an empty queue")
+	}
+	c, capped := q.(interface{ Cap() int })
+	if capped && c.Cap() < p.queue.len() {
+		return fmt.Errorf("concpool: SetQueue: queue holds %d tasks, %d are queued", c.Cap(), p.queue.len())
+	}
+
+	jobs := p.queue.clear()
+	slices.SortFunc(jobs, func(a, b *job) int { return cmp.Compare(a.id, b.id) })
+	queue := newExternalQueue(q)
+	for _, t := range jobs {
+		queue.push(t)
+	}
+	p.queue = queue
+	p.userQueue = q
+	if capped && (p.maxQueue == 0 || p.maxQueue > c.Cap()) {
+		p.maxQueue = c.Cap()
+	}
+	return nil
+}
+
+// MaxConcurrency returns the current concurrency limit.
+func (p *Pool) MaxConcurrency() int {
+	p.lazyInit()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.maxCount
+}
+
+// Name returns the name set with WithName, or "default" if none was set.
+func (p *Pool) Name() string {
+	if p.name == "" {
+		return "default"
+	}
+	return p.name
+}
+
+// OnComplete registers fn to be called with the result of every task that
+// runs, as soon as it finishes and before the result reaches Wait. A later
+// call replaces the previous callback; pass nil to remove it. Tasks dropped
+// without running (cancelled ones, for example) don't trigger it.
+//
+// fn is called from the worker goroutine that ran the task, so it must be
+// safe for concurrent use and should return quickly: the worker stays busy
+// until it does.
+func (p *Pool) OnComplete(fn func(TaskResult)) {
+	p.lazyInit()
+	p.mu.Lock()
+	p.onComplete = fn
+	p.mu.Unlock()
+}
+
+// OnError is like OnComplete but fn is only called for tasks that failed.
+// It is independent of OnComplete; when both are set, the OnComplete
+// callback runs first.
+func (p *Pool) OnError(fn func(TaskResult)) {
+	p.lazyInit()
+	p.mu.Lock()
+	p.onError = fn
+	p.mu.Unlock()
+}
+
+// Running returns how much of the concurrency limit is in use: the number
+// of tasks currently executing, with tasks submitted with RunWeighted
+// counting as their weight, plus the slots held through Semaphore.
+func (p *Pool) Running() int {
+	p.lazyInit()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.running
+}
+
+// Pending returns the number of tasks waiting in the queue.
+func (p *Pool) Pending() int {
+	p.lazyInit()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.queue.len()
+}
+
+// PoolStats is a point-in-time view of a pool. The uint64 fields are
+// cumulative since the pool was created or last Reset: every submitted task
+// is eventually counted once as Started or Cancelled, and every started task
+// once as Completed (succeeded) or Failed.
+type PoolStats struct {
+	// Name is the pool's name, see Pool.Name.
+	Name string `json:"name"`
+
+	Submitted uint64 `json:"submitted"`
+	Started   uint64 `json:"started"`
+	Completed uint64 `json:"completed"`
+	Failed    uint64 `json:"failed"`
+	Cancelled uint64 `json:"cancelled"`
+
+	CurrentRunning int `json:"current_running"`
+	CurrentPending int `json:"current_pending"`
+	// MaxConcurrency is the concurrency limit in effect, which changes over
+	// time for pools created with NewAutoScaling.
+	MaxConcurrency int `json:"max_concurrency"`
+	// FailureCount is the number of failures counted against the limit set
+	// by WithMaxFailures. It counts every failed task, like Failed.
+	FailureCount uint64 `json:"failure_count"`
+	// CircuitState is the state of the circuit breaker set up by
+	// WithCircuitBreaker: CircuitClosed, CircuitOpen or CircuitHalfOpen. It
+	// is empty for pools without one.
+	CircuitState string `json:"circuit_state"`
+	// CurrentTokens is how many tasks a pool created with NewRateLimited
+	// could start right now without waiting for the rate limit. It is zero
+	// for other pools.
+	CurrentTokens float64 `json:"current_tokens"`
+	// Terminated reports whether the pool has finished its batch.
+	Terminated bool `json:"terminated"`
+	// Goroutines is the number of goroutines the pool has started that
+	// are still running: workers, timed-out tasks, subscribers and the
+	// like. Workers exit shortly after the pool terminates, so it can take
+	// a moment to reach zero.
+	Goroutines int `json:"goroutines"`
+}
+
+// Stats returns the pool's current statistics. It is safe to call from any
+// goroutine at any time. The counters are read without locking, so a
+// snapshot taken while tasks are in flight may be off by a task or two.
+func (p *Pool) Stats() PoolStats {
+	p.lazyInit()
+	p.mu.Lock()
+	running, pending, limit, terminated := p.running, p.queue.len(), p.maxCount, p.terminated
+	var circuit string
+	if p.breaker != nil {
+		circuit = p.breaker.state
+	}
+	var tokens float64
+	if p.limiter != nil {
+		p.limiter.refill(time.Now())
+		tokens = p.limiter.tokens
+	}
+	p.mu.Unlock()
+	failed := p.counts.failed.Load()
+
+	return PoolStats{
+		Name:           p.Name(),
+		Submitted:      p.counts.submitted.Load(),
+		Started:        p.counts.started.Load(),
+		Completed:      p.counts.completed.Load(),
+		Failed:         failed,
+		Cancelled:      p.counts.cancelled.Load(),
+		CurrentRunning: running,
+		CurrentPending: pending,
+		MaxConcurrency: limit,
+		FailureCount:   failed,
+		CircuitState:   circuit,
+		CurrentTokens:  tokens,
+		Terminated:     terminated,
+		Goroutines:     int(p.goroutines.Load()),
+	}
+}
+
+// TotalSubmitted returns how many tasks have been submitted over the pool's
+// whole lifetime. Unlike the Stats counters, it and TotalCompleted and
+// TotalFailed are not cleared by Reset, so together they give a lifetime
+// success rate for pools reused across many batches.
+func (p *Pool) TotalSubmitted() uint64 {
+	p.lazyInit()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.earlier.submitted + p.counts.submitted.Load()
+}
+
+// TotalCompleted is like TotalSubmitted but counts the tasks that
+// succeeded.
+func (p *Pool) TotalCompleted() uint64 {
+	p.lazyInit()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.earlier.completed + p.counts.completed.Load()
+}
+
+// TotalFailed is like TotalSubmitted but counts the tasks that failed.
+func (p *Pool) TotalFailed() uint64 {
+	p.lazyInit()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.earlier.failed + p.counts.failed.Load()
+}
+
+// Reset prepares a pool for a new batch of tasks after Wait has returned,
+// so it doesn't have to be reallocated. It discards anything still queued,
+// clears the cancelled state, and restarts task IDs and the Stats counters
+// from zero. The concurrency limit and paused state are kept. RunAfter
+// tasks that came due after the last batch finished are submitted to the
+// new one.
+//
+// Reset panics if tasks are still running.
+func (p *Pool) Reset() {
+	for _, st := range p.reset() {
+		st.submit(p)
+	}
+}
+
+// reset does the work of Reset and returns the RunAfter tasks held over
+// for the new batch, which are submitted once p.mu is released.
+func (p *Pool) reset() []*ScheduledTask {
+	p.lazyInit()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.running > 0 {
+		panic("concpool: Reset called while tasks are running")
+	}
+
+	// drop any result left behind by a WaitContext that returned early
+	for len(p.results) > 0 {
+		<-p.results
+	}
+
+	// clear stale signals; a worker that just finished may still poke
+	// runCheckChannel, which only causes a harmless extra check
+	for len(p.runCheckChannel) > 0 {
+		<-p.runCheckChannel
+	}
+
+	p.queue.clear()
+	p.signalSpace()
+	p.dropped = nil
+	p.deferred = nil
+	p.journal = nil
+	p.stopWorkers()
+	p.terminated = false
+	p.prewarm(p.minWorkers)
+	p.cancelled = false
+	p.stream = nil
+	p.shuttingDown = false
+	p.done = make(chan struct{})
+	p.abandoned = make(chan struct{})
+
+	p.lastID.Store(0)
+	p.earlier.submitted += p.counts.submitted.Load()
+	p.earlier.completed += p.counts.completed.Load()
+	p.earlier.failed += p.counts.failed.Load()
+	p.counts.reset()
+
+	late := p.late
+	p.late = nil
+	return late
+}
+
+// Pause stops the pool from starting queued tasks. Tasks that are already
+// running continue, and new tasks can still be submitted; they wait in the
+// queue until Resume is called.
+func (p *Pool) Pause() {
+	p.lazyInit()
+	p.mu.Lock()
+	p.paused = true
+	p.mu.Unlock()
+}
+
+// Resume lets a paused pool start queued tasks again. It also re-arms the
+// OnIdle callback.
+func (p *Pool) Resume() {
+	p.lazyInit()
+	p.mu.Lock()
+	p.paused = false
+	p.idleArmed = p.onIdle != nil
+	p.mu.Unlock()
+
+	p.attemptCheck()
+}
+
+// Shutdown stops the pool from accepting new tasks and waits for the ones
+// already submitted to finish, like Wait. Submitting a task after Shutdown
+// has been called panics.
+//
+// If ctx is done first, Shutdown stops waiting: queued tasks are dropped as
+// by Cancel, tasks that are still running are reported as failed with
+// ErrTimeout, and Shutdown returns all results gathered so far together
+// with ctx.Err(). The goroutines of those abandoned tasks keep running, but
+// their results are discarded.
+func (p *Pool) Shutdown(ctx context.Context) ([]TaskResult, error) {
+	p.lazyInit()
+	p.mu.Lock()
+	p.shuttingDown = true
+	p.mu.Unlock()
+
+	results, err := p.collect(ctx)
+	if err == nil {
+		return results, nil
+	}
+
+	p.Cancel()
+
+	p.mu.Lock()
+	for _, t := range p.inflight {
+		if t.settled.CompareAndSwap(false, true) {
+			r := TaskResult{ID: t.id, Index: t.index(), Name: t.name, Success: false, Err: ErrTimeout, SubmissionStack: t.stack, Meta: t.meta}
+			p.counts.failed.Add(1)
+			if t.group == nil {
+				results = append(results, r)
+			}
+			t.settle(r)
+			p.skip(t.serial)
+		}
+	}
+	p.terminated = true
+	p.stopWorkers()
+	p.abandon()
+	p.mu.Unlock()
+
+	results = append(results, p.takeDropped()...)
+	// pick up results that workers handed over before the deadline
+	for {
+		select {
+		case r := <-p.results:
+			results = append(results, r)
+		default:
+			return results, err
+		}
+	}
+}
+
+// abandon closes p.abandoned unless it already is. The caller must hold
+// p.mu.
+func (p *Pool) abandon() {
+	select {
+	case <-p.abandoned:
+	default:
+		close(p.abandoned)
+	}
+}
+
+// checkAccepting panics if the pool has been shut down.
+func (p *Pool) checkAccepting() {
+	p.lazyInit()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.shuttingDown {
+		panic("concpool: task submitted after Shutdown")
+	}
+}
+
+// Discard removes every task that has not started yet and returns how many
+// there were. Unlike Cancel, discarded tasks produce no results at all:
+// they simply vanish from the queue, and the pool keeps accepting and
+// running new tasks. A Future for a discarded task resolves as cancelled
+// with ErrCancelled. Discarded tasks are counted as Cancelled in Stats.
+func (p *Pool) Discard() int {
+	p.lazyInit()
+	p.mu.Lock()
+	jobs := p.discardQueue()
+	onDiscard := p.onDiscard
+	onIdle := p.takeIdleCallback()
+	p.mu.Unlock()
+
+	// the queue may now be empty, which lets the pool terminate
+	p.attemptCheck()
+
+	if onDiscard != nil && len(jobs) > 0 {
+		onDiscard(len(jobs))
+	}
+	if onIdle != nil {
+		onIdle()
+	}
+	return len(jobs)
+}
+
+// discardQueue empties the queue without reporting results and returns
+// the jobs it held. The caller must hold p.mu.
+func (p *Pool) discardQueue() []*job {
+	jobs := p.queue.clear()
+	p.signalSpace()
+	for _, t := range jobs {
+		if !t.take() {
+			continue
+		}
+		p.counts.cancelled.Add(1)
+		t.settle(TaskResult{ID: t.id, Index: t.index(), Name: t.name, Success: false, Err: ErrCancelled, Cancelled: true, SubmissionStack: t.stack, Meta: t.meta})
+	}
+	return jobs
+}
+
+// OnDiscard registers fn to be called with the number of tasks removed
+// each time Discard drops at least one. A later call replaces the previous
+// callback. fn runs on the goroutine that called Discard.
+func (p *Pool) OnDiscard(fn func(n int)) {
+	p.lazyInit()
+	p.mu.Lock()
+	p.onDiscard = fn
+	p.mu.Unlock()
+}
+
+// OnIdle registers fn to be called once, the next time the pool goes idle:
+// its queue is empty and no task is running. If the pool is already idle,
+// fn is called straight away on a new goroutine; otherwise it runs on the
+// goroutine that made the pool idle, usually the worker that finished the
+// last task. Resume arms fn again, so a pool that is paused and resumed
+// reports going idle once more. A later call replaces the previous
+// callback, and a nil fn removes it.
+func (p *Pool) OnIdle(fn func()) {
+	p.lazyInit()
+	p.mu.Lock()
+	p.onIdle = fn
+	p.idleArmed = fn != nil
+	onIdle := p.takeIdleCallback()
+	p.mu.Unlock()
+
+	if onIdle != nil {
+		go onIdle()
+	}
+}
+
+// takeIdleCallback returns the OnIdle callback and disarms it if it is
+// armed and the pool is idle, or returns nil. The caller must hold p.mu
+// and call the returned function after unlocking.
+func (p *Pool) takeIdleCallback() func() {
+	if !p.idleArmed || p.running > 0 || p.queue.len() > 0 {
+		return nil
+	}
+	p.idleArmed = false
+	return p.onIdle
+}
+
+// RunFromChannel submits every task received from ch, as Run would, from a
+// goroutine of its own, until ch is closed or the pool is cancelled. The
+// returned channel is closed once it has stopped, i.e. when every task
+// from ch has been submitted (not finished). Until then the pool doesn't
+// terminate, so Wait also covers tasks that haven't been sent yet.
+func (p *Pool) RunFromChannel(ch <-chan func() error) <-chan struct{} {
+	p.checkAccepting()
+
+	p.mu.Lock()
+	p.feeders++
+	cancelled := p.done
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	p.spawn(func() {
+		defer func() {
+			p.mu.Lock()
+			p.feeders--
+			p.mu.Unlock()
+			p.attemptCheck()
+			close(done)
+		}()
+
+		for {
+			select {
+			case task, ok := <-ch:
+				if !ok {
+					return
+				}
+				p.Run(task)
+			case <-cancelled:
+				return
+			}
+		}
+	})
+	return done
+}
+
+// BufferedRun returns a channel with room for n tasks that feeds the pool
+// through RunFromChannel, so a producer can submit tasks by sending them
+// instead of calling Run, along with a done channel that is closed once the
+// task channel has been closed and every task sent on it submitted. The
+// producer closes the task channel when it is done; the pool never does,
+// since a send on a closed channel would panic. Until it is closed the pool
+// doesn't terminate, so Wait covers every task sent. Once the pool is
+// cancelled, tasks still sent are discarded without being run or reported,
+// so producers never block on a buffer nobody drains.
+func (p *Pool) BufferedRun(n int) (tasks chan<- func() error, done <-chan struct{}) {
+	ch := make(chan func() error, n)
+	fed := p.RunFromChannel(ch)
+	drained := make(chan struct{})
+	p.spawn(func() {
+		<-fed
+		// RunFromChannel stops early if the pool was cancelled
+		for range ch {
+		}
+		close(drained)
+	})
+	return ch, drained
+}
+
+// RunnerHandle tracks the goroutine started by RunIterator.
+type RunnerHandle struct {
+	done chan struct{}
+}
+
+// Done returns a channel that is closed once the iterator has stopped.
+func (h *RunnerHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+// RunIterator submits the tasks produced by iter, from a goroutine of its
+// own, calling it until it returns false or the pool is cancelled. Unlike
+// Run, it waits for room when the queue is full (see WithMaxQueue) instead
+// of rejecting the task, so with a bounded queue iter is only called as
+// fast as the pool starts tasks, and the full task set never has to be in
+// memory at once. As with RunFromChannel, the pool doesn't terminate until
+// the iterator has stopped.
+func (p *Pool) RunIterator(iter func() (func() error, bool)) *RunnerHandle {
+	p.checkAccepting()
+
+	p.mu.Lock()
+	p.feeders++
+	cancelled := p.done
+	p.mu.Unlock()
+
+	h := &RunnerHandle{done: make(chan struct{})}
+	p.spawn(func() {
+		defer func() {
+			p.mu.Lock()
+			p.feeders--
+			p.mu.Unlock()
+			p.attemptCheck()
+			close(h.done)
+		}()
+
+		for {
+			select {
+			case <-cancelled:
+				return
+			default:
+			}
+
+			task, ok := iter()
+			if !ok {
+				return
+			}
+			t := &job{fn: task}
+			for {
+				space := p.spaceSignal()
+				if p.tryPush(t) {
+					break
+				}
+				select {
+				case <-space:
+				case <-cancelled:
+					return
+				}
+			}
+		}
+	})
+	return h
+}
+
+// Hold keeps the pool from terminating until the returned release function
+// is called, for submissions that happen after the current task has
+// returned: a task that hands follow-up work to another goroutine calls
+// Hold before returning, and that goroutine calls release once it has
+// submitted everything. Until then Wait keeps waiting even if nothing is
+// queued or running. Calling release more than once has no further effect.
+func (p *Pool) Hold() (release func()) {
+	p.checkAccepting()
+
+	p.mu.Lock()
+	p.feeders++
+	p.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.mu.Lock()
+			p.feeders--
+			p.mu.Unlock()
+			p.attemptCheck()
+		})
+	}
+}
+
+// Defer registers a teardown task to run once all other tasks have
+// finished, like a deferred function call: when the queue is empty and
+// nothing is running, the deferred tasks run one at a time, last registered
+// first, and Wait returns after the last of them. They run even if the
+// pool was cancelled, and tasks they submit run before the next deferred
+// task. Their results are included in what Wait returns, with Deferred set.
+func (p *Pool) Defer(task func() error) {
+	p.checkAccepting()
+
+	t := &job{fn: task, deferred: true, id: p.lastID.Add(1), stack: p.captureStack(1)}
+	p.counts.submitted.Add(1)
+
+	p.mu.Lock()
+	p.deferred = append(p.deferred, t)
+	p.mu.Unlock()
+}
+
+// RunBounded submits a task like Run, but if the queue is full (see
+// WithMaxQueue) it blocks until there is room, for at most maxWait. If the
+// queue is still full by then, the task is not submitted and ErrQueueFull
+// is returned. This gives producers backpressure instead of rejected
+// results. Queued tasks only make room as they start, so the pool must be
+// waited on for a blocked RunBounded to proceed, and tasks submitting to
+// their own pool should use Run or TryRun: if every running task is
+// blocked in RunBounded, none of them frees a slot until maxWait passes.
+func (p *Pool) RunBounded(maxWait time.Duration, task func() error) error {
+	t := &job{fn: task}
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+
+	for {
+		// take the channel before trying, so room made in between isn't
+		// missed
+		space := p.spaceSignal()
+		if p.tryPush(t) {
+			return nil
+		}
+
+		select {
+		case <-space:
+		case <-timer.C:
+			return ErrQueueFull
+		}
+	}
+}
+
+// TryRun submits a task like Run if the queue has room for it and reports
+// whether it did. Unlike Run, a task that doesn't fit is not reported as a
+// result at all.
+func (p *Pool) TryRun(task func() error) bool {
+	return p.tryPush(&job{fn: task})
+}
+
+// tryPush queues t, assigning its ID, unless the queue is full.
+func (p *Pool) tryPush(t *job) bool {
+	p.checkAccepting()
+
+	p.mu.Lock()
+	if p.maxQueue > 0 && p.queue.len() >= p.maxQueue {
+		p.mu.Unlock()
+		return false
+	}
+	t.id = p.lastID.Add(1)
+	t.stack = p.captureStack(2)
+	p.counts.submitted.Add(1)
+	p.queue.push(t)
+	depth := p.queue.len()
+	p.mu.Unlock()
+
+	if p.observed() {
+		p.logSubmitted(t, depth)
+	}
+	p.attemptCheck()
+	return true
+}
+
+// spaceSignal returns a channel that is closed the next time a task leaves
+// the queue.
+func (p *Pool) spaceSignal() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.space == nil {
+		p.space = make(chan struct{})
+	}
+	return p.space
+}
+
+// waitForRoom blocks, for WithOverflowBlock, until the queue has room or
+// the pool is terminated or cancelled, in which case the caller goes on to
+// report the task as usual. The caller must hold p.mu; it is released
+// while waiting. A waiting submitter counts as a feeder, so the pool
+// doesn't terminate between the queue draining and the task being pushed.
+func (p *Pool) waitForRoom() {
+	for p.maxQueue > 0 && p.queue.len() >= p.maxQueue && !p.terminated && !p.cancelled {
+		if p.space == nil {
+			p.space = make(chan struct{})
+		}
+		space := p.space
+		p.feeders++
+		p.mu.Unlock()
+		<-space
+		p.mu.Lock()
+		p.feeders--
+	}
+}
+
+// signalSpace wakes RunBounded callers after tasks have left the queue.
+// The caller must hold p.mu.
+func (p *Pool) signalSpace() {
+	if p.space != nil {
+		close(p.space)
+		p.space = nil
+	}
+}
+
+// submit assigns the next ID to t and queues it.
+func (p *Pool) submit(t *job) uint64 {
+	p.checkAccepting()
+
+	t.id = p.lastID.Add(1)
+	t.stack = p.captureStack(2)
+	p.counts.submitted.Add(1)
+	p.pushToQueue(t)
+	p.attemptCheck()
+	return t.id
+}
+
+// Wait blocks until all submitted tasks have finished and returns the
+// slice of TaskResult values in the order they completed.
+//
+// If Results has been called, the results are delivered on that channel
+// instead and Wait returns nil straight away.
+func (p *Pool) Wait() []TaskResult {
+	results, _ := p.WaitContext(context.Background())
+	return results
+}
+
+// ForEachResult is like Wait but calls fn with each result as it arrives
+// instead of collecting them into a slice. fn is called from the calling
+// goroutine, one result at a time, so it needs no locking of its own; the
+// pool's workers keep running while it does.
+func (p *Pool) ForEachResult(fn func(TaskResult)) {
+	p.ForEachResultContext(context.Background(), fn)
+}
+
+// ForEachResultContext is like ForEachResult but returns early with
+// ctx.Err() when ctx is done, leaving the remaining work in the pool as
+// WaitContext does.
+func (p *Pool) ForEachResultContext(ctx context.Context, fn func(TaskResult)) error {
+	p.lazyInit()
+	p.mu.Lock()
+	streaming := p.stream != nil
+	p.mu.Unlock()
+	if streaming {
+		return nil
+	}
+	return p.loop(ctx, fn)
+}
+
+// Flush starts whatever queued tasks the concurrency limit allows, waits
+// for the tasks running at that point to finish, and returns every result
+// collected in the meantime. Unlike Wait it doesn't wait for the queue to
+// drain and doesn't end the batch: the pool keeps accepting and running
+// tasks, so a producer can keep submitting while another goroutine calls
+// Flush periodically to process results in batches. Flush must not be
+// called concurrently with Wait or another Flush.
+func (p *Pool) Flush() []TaskResult {
+	p.lazyInit()
+	p.mu.Lock()
+	streaming := p.stream != nil
+	p.mu.Unlock()
+	if streaming {
+		return nil
+	}
+
+	p.checkQueue()
+
+	p.mu.Lock()
+	ids := p.inflightIDs()
+	p.mu.Unlock()
+	return p.collectRunning(ids)
+}
+
+// WaitDrain ends the batch without starting anything new, for shutting
+// down gracefully: it discards the queued tasks as Discard does, waits for
+// the tasks already running to finish, and returns their results along
+// with any others not collected yet. Tasks registered with Defer don't run.
+// The pool is terminated afterwards, so tasks submitted later don't start
+// until Reset. Since only Wait and its variants start queued tasks, this
+// is typically called after WaitContext or ForEachResultContext has
+// returned early; it must not be called concurrently with them, Flush or
+// another WaitDrain.
+func (p *Pool) WaitDrain() []TaskResult {
+	p.lazyInit()
+	p.mu.Lock()
+	if p.stream != nil {
+		p.mu.Unlock()
+		return nil
+	}
+	// with the pool terminated, workers that finish don't pick up
+	// anything else
+	p.terminated = true
+	p.stopWorkers()
+	discarded := len(p.discardQueue()) + len(p.deferred)
+	for _, t := range p.deferred {
+		p.counts.cancelled.Add(1)
+		t.settle(TaskResult{ID: t.id, Index: t.index(), Name: t.name, Success: false, Err: ErrCancelled, Cancelled: true, Deferred: true, SubmissionStack: t.stack, Meta: t.meta})
+	}
+	p.deferred = nil
+	ids := p.inflightIDs()
+	onDiscard := p.onDiscard
+	p.mu.Unlock()
+
+	if onDiscard != nil && discarded > 0 {
+		onDiscard(discarded)
+	}
+
+	results := p.collectRunning(ids)
+	if p.logger != nil {
+		p.logTerminated()
+	}
+	return results
+}
+
+// inflightIDs returns the IDs of the running tasks. The caller must hold
+// p.mu.
+func (p *Pool) inflightIDs() []uint64 {
+	ids := make([]uint64, 0, len(p.inflight))
+	for id := range p.inflight {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// collectRunning collects results until none of the tasks with the given
+// IDs are running any more, and returns them along with every other result
+// that has arrived by then.
+func (p *Pool) collectRunning(ids []uint64) []TaskResult {
+	// a job leaves inflight only after its result has been handed over,
+	// or with WithAsyncDispatch, once its hand-off has been started
+	running := func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.dispatching > 0 {
+			return true
+		}
+		for _, id := range ids {
+			if _, ok := p.inflight[id]; ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	results := p.takeDropped()
+	for running() {
+		select {
+		case <-p.runCheckChannel:
+		case r := <-p.results:
+			results = append(results, r)
+		}
+		results = append(results, p.takeDropped()...)
+	}
+
+	for {
+		select {
+		case r := <-p.results:
+			results = append(results, r)
+		default:
+			return append(results, p.takeDropped()...)
+		}
+	}
+}
+
+var _ io.Closer = (*Pool)(nil)
+
+// Close makes Pool an io.Closer, so it can be used as defer p.Close(). It
+// blocks like Wait until every submitted task has finished, discards the
+// results, and returns a *MultiError (see CollectErrors) if any task
+// failed, or nil. If the pool has already been waited on to completion,
+// Close does nothing and returns nil.
+func (p *Pool) Close() error {
+	p.lazyInit()
+	p.mu.Lock()
+	terminated := p.terminated
+	p.mu.Unlock()
+	if terminated {
+		return nil
+	}
+	return CollectErrors(p.Wait())
+}
+
+// WaitAccumulate is like Wait but also returns a *MultiError holding every
+// failure (see CollectErrors), or nil if all tasks succeeded. The results
+// are in completion order and include the failed tasks.
+func (p *Pool) WaitAccumulate() ([]TaskResult, error) {
+	results := p.Wait()
+	return results, CollectErrors(results)
+}
+
+// WaitError is like Wait but returns only the error of the first task to
+// fail, in completion order, or nil if none did. Tasks that were cancelled
+// without running are not counted as failures unless the pool was created
+// with WithCancelledAsError.
+func (p *Pool) WaitError() error {
+	if errs := p.WaitErrors(); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// WaitErrors is like WaitError but returns the errors of every failed task,
+// in completion order, or nil if none failed.
+func (p *Pool) WaitErrors() []error {
+	var errs []error
+	for _, r := range p.Wait() {
+		if r.Success || r.Cancelled && !p.cancelledAsError {
+			continue
+		}
+		errs = append(errs, r.Err)
+	}
+	return errs
+}
+
+// Must is like Wait, but panics with a *MultiError holding every failure
+// if any task was unsuccessful (see the package-level Must). It is meant for
+// scripts and tests; do not use it in server code.
+func (p *Pool) Must() []TaskResult {
+	results := p.Wait()
+	Must(results)
+	return results
+}
+
+// WaitMap is like Wait but returns the results keyed by task ID, for
+// direct lookup by the IDs Run returned.
+func (p *Pool) WaitMap() map[uint64]TaskResult {
+	results := p.Wait()
+	m := make(map[uint64]TaskResult, len(results))
+	for _, r := range results {
+		m[r.ID] = r
+	}
+	return m
+}
+
+// WaitMapNamed is like Wait but returns the results of named tasks (see
+// RunNamed) keyed by name. Results of unnamed tasks are left out, and if
+// several tasks share a name, the one that finished last wins.
+func (p *Pool) WaitMapNamed() map[string]TaskResult {
+	results := p.Wait()
+	m := make(map[string]TaskResult, len(results))
+	for _, r := range results {
+		if r.Name != "" {
+			m[r.Name] = r
+		}
+	}
+	return m
+}
+
+// WaitOrdered is like Wait but returns the results in submission order, so
+// results[i] belongs to the i-th task submitted since the pool was created
+// or last Reset.
+func (p *Pool) WaitOrdered() []TaskResult {
+	results := p.Wait()
+	slices.SortFunc(results, func(a, b TaskResult) int {
+		return cmp.Compare(a.Index, b.Index)
+	})
+	return results
+}
+
+// WaitContext is like Wait but returns early when ctx is done, with the
+// results collected so far and ctx.Err(). Tasks that are still queued or
+// running are left untouched, not cancelled (use Cancel for that); a later
+// call to Wait picks up where this one stopped.
+func (p *Pool) WaitContext(ctx context.Context) ([]TaskResult, error) {
+	return p.collect(ctx)
+}
+
+// WaitWithContext is the same as WaitContext.
+//
+// Deprecated: Use WaitContext.
+func (p *Pool) WaitWithContext(ctx context.Context) ([]TaskResult, error) {
+	return p.WaitContext(ctx)
+}
+
+// WaitWithTimeout is like WaitContext with a deadline d from now. It
+// returns the results collected so far and whether d elapsed before every
+// task had finished. The pool is not cancelled on timeout; call Wait again
+// to collect the rest.
+func (p *Pool) WaitWithTimeout(d time.Duration) (results []TaskResult, timedOut bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	results, err := p.WaitContext(ctx)
+	return results, err != nil
+}
+
+// WaitFirst blocks until any task has finished and returns its result,
+// then cancels the pool. It is WaitN with n == 1; see there for what
+// happens to the remaining tasks. If no task was submitted, the zero
+// TaskResult is returned.
+func (p *Pool) WaitFirst() TaskResult {
+	results := p.WaitN(1)
+	if len(results) == 0 {
+		return TaskResult{}
+	}
+	return results[0]
+}
+
+// WaitFirstN is the same as WaitN.
+func (p *Pool) WaitFirstN(n int) []TaskResult {
+	return p.WaitN(n)
+}
+
+// WaitN blocks until n tasks have finished, or all of them if fewer were
+// submitted, and returns exactly those results in completion order. It
+// then cancels the pool as Cancel does. Tasks may be submitted while WaitN
+// is blocked and count towards n. Tasks that are still running are left
+// to finish, but their results, and those of the cancelled tasks, are
+// discarded: they are not returned by a later Wait and only reach their
+// Futures and callbacks. The pool must be Reset before it is reused, which
+// in turn requires the running tasks to have finished; calling Wait first
+// blocks until they have.
+func (p *Pool) WaitN(n int) []TaskResult {
+	p.lazyInit()
+	p.mu.Lock()
+	streaming := p.stream != nil
+	p.mu.Unlock()
+	if streaming || n <= 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := make([]TaskResult, 0, n)
+	p.loop(ctx, func(r TaskResult) {
+		if len(results) < n {
+			results = append(results, r)
+		}
+		if len(results) == n {
+			cancel()
+		}
+	})
+
+	p.Cancel()
+
+	// results already handed over go with the old channel; later ones are
+	// turned away by abandoned
+	p.mu.Lock()
+	p.abandon()
+	p.dropped = nil
+	p.results = make(chan TaskResult, cap(p.results))
+	p.mu.Unlock()
+	return results
+}
+
+// Results returns a channel on which every TaskResult is delivered as soon
+// as it is available, so results can be processed while other tasks are
+// still running. The channel is closed once all submitted tasks have
+// finished, so it can be consumed with a range loop. Calling Results again
+// returns the same channel.
+//
+// Results takes over from Wait: once it has been called, Wait and
+// WaitContext return immediately without collecting anything. A slow
+// consumer holds up workers, since each one waits for its result to be
+// received before taking the next task.
+func (p *Pool) Results() <-chan TaskResult {
+	p.lazyInit()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stream == nil {
+		p.stream = make(chan TaskResult)
+		out := p.stream
+		p.spawn(func() {
+			p.loop(context.Background(), func(r TaskResult) {
+				out <- r
+			})
+			close(out)
+		})
+	}
+	return p.stream
+}
+
+// collect gathers results into a slice until the pool terminates or ctx is
+// done.
+func (p *Pool) collect(ctx context.Context) ([]TaskResult, error) {
+	p.lazyInit()
+	p.mu.Lock()
+	streaming := p.stream != nil
+	// size for the tasks already submitted, so a large batch isn't
+	// collected through repeated regrowth
+	pending := p.queue.len() + len(p.inflight)
+	p.mu.Unlock()
+	if streaming {
+		return nil, nil
+	}
+
+	results := make([]TaskResult, 0, pending)
+	err := p.loop(ctx, func(r TaskResult) {
+		results = append(results, r)
+	})
+	return results, err
+}
+
+// loop runs the event loop that hands each result to emit, until the pool
+// terminates or ctx is done. The loop starts queued tasks on the pool's
+// workers; a worker that finishes a task picks up the next queued one by
+// itself, so the loop mostly just collects results.
+func (p *Pool) loop(ctx context.Context, emit func(TaskResult)) error {
+	p.lazyInit()
+	emitDropped := func() {
+		for _, r := range p.takeDropped() {
+			emit(r)
+		}
+	}
+
+	for {
+		p.checkQueue()
+		emitDropped()
+		if p.attemptTermination() {
+			// every worker has sent its result by the time the pool
+			// terminates, but the last ones may still sit in the buffer
+			for {
+				select {
+				case r := <-p.results:
+					emit(r)
+				default:
+					emitDropped()
+					return nil
+				}
+			}
+		}
+
+		select {
+		case <-p.runCheckChannel:
+		case r := <-p.results:
+			emit(r)
+		case <-ctx.Done():
+			emitDropped()
+			return ctx.Err()
 		}
 	}
 }
@@ -0,0 +1,1948 @@
+package concpool
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestZeroValuePool(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(p *Pool)
+	}{
+		{"OnIdle", func(p *Pool) { p.OnIdle(func() {}) }},
+		{"Pause", func(p *Pool) { p.Pause(); p.Resume() }},
+		{"Resume", func(p *Pool) { p.Resume() }},
+		{"OnComplete", func(p *Pool) { p.OnComplete(func(TaskResult) {}) }},
+		{"OnError", func(p *Pool) { p.OnError(func(TaskResult) {}) }},
+		{"OnDiscard", func(p *Pool) { p.OnDiscard(func(int) {}) }},
+		{"OnResultBlocking", func(p *Pool) { p.OnResultBlocking(func(TaskResult) {}) }},
+		{"Use", func(p *Pool) { p.Use(func(next func() error) func() error { return next }) }},
+		{"Running", func(p *Pool) { p.Running() }},
+		{"TotalSubmitted", func(p *Pool) { p.TotalSubmitted() }},
+		{"Journal", func(p *Pool) { p.Journal() }},
+		{"ConcurrencyHistory", func(p *Pool) { p.ConcurrencyHistory() }},
+		{"Close", func(p *Pool) { p.Close(); p.Reset() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p Pool
+			tt.call(&p)
+
+			p.Run(func() error { return nil })
+			if results := p.Wait(); len(results) != 1 || !results[0].Success {
+				t.Fatalf("Wait() = %+v, want one successful result", results)
+			}
+		})
+	}
+}
+
+func TestZeroValuePoolWaitFirst(t *testing.T) {
+	tests := []struct {
+		name string
+		wait func(p *Pool) int
+	}{
+		{"Wait", func(p *Pool) int { return len(p.Wait()) }},
+		{"WaitContext", func(p *Pool) int {
+			results, _ := p.WaitContext(context.Background())
+			return len(results)
+		}},
+		{"WaitMap", func(p *Pool) int { return len(p.WaitMap()) }},
+		{"WaitErrors", func(p *Pool) int { return len(p.WaitErrors()) }},
+		{"WaitAccumulate", func(p *Pool) int {
+			results, _ := p.WaitAccumulate()
+			return len(results)
+		}},
+		{"WaitProgress", func(p *Pool) int { return len(p.WaitProgress(time.Millisecond, func(int, int) {})) }},
+		{"ForEachResult", func(p *Pool) int {
+			n := 0
+			p.ForEachResult(func(TaskResult) { n++ })
+			return n
+		}},
+		{"ForEachResultContext", func(p *Pool) int {
+			n := 0
+			p.ForEachResultContext(context.Background(), func(TaskResult) { n++ })
+			return n
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p Pool
+			if n := tt.wait(&p); n != 0 {
+				t.Fatalf("%s on an empty zero-value pool collected %d results", tt.name, n)
+			}
+			// the pool works normally after the first batch
+			p.Reset()
+			p.Run(func() error { return nil })
+			if results := p.Wait(); len(results) != 1 || !results[0].Success {
+				t.Fatalf("Wait() = %+v, want one successful result", results)
+			}
+		})
+	}
+}
+
+func TestBufferedRun(t *testing.T) {
+	p := New(WithMaxConcurrency(8))
+	tasks, done := p.BufferedRun(16)
+	if c := reflect.ValueOf(tasks).Cap(); c != 16 {
+		t.Fatalf("buffer capacity = %d, want 16", c)
+	}
+
+	var ran atomic.Int64
+	go func() {
+		for i := 0; i < 1000; i++ {
+			tasks <- func() error {
+				ran.Add(1)
+				return nil
+			}
+		}
+		close(tasks)
+	}()
+
+	results := p.Wait()
+	if len(results) != 1000 || ran.Load() != 1000 {
+		t.Fatalf("Wait() returned %d results after %d tasks ran, want 1000", len(results), ran.Load())
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("done not closed after the channel was closed and drained")
+	}
+}
+
+func TestBufferedRunAfterCancel(t *testing.T) {
+	p := New(WithMaxConcurrency(1))
+	tasks, done := p.BufferedRun(1)
+	p.Cancel()
+	p.Wait()
+
+	sent := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			tasks <- func() error {
+				t.Error("task ran after Cancel")
+				return nil
+			}
+		}
+		close(tasks)
+		close(sent)
+	}()
+	for _, c := range []<-chan struct{}{sent, done} {
+		select {
+		case <-c:
+		case <-time.After(5 * time.Second):
+			t.Fatal("producer blocked on the buffer of a cancelled pool")
+		}
+	}
+}
+
+func TestRunWithContext(t *testing.T) {
+	p := New(WithMaxConcurrency(1))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	runningID := p.RunWithContext(ctx, func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	for i := 0; i < 5; i++ {
+		p.RunWithContext(ctx, func() error {
+			t.Error("queued task ran after its context was cancelled")
+			return nil
+		})
+	}
+	p.Run(func() error { return nil })
+
+	go func() {
+		<-started
+		cancel()
+		close(release)
+	}()
+	results := p.Wait()
+	if len(results) != 7 {
+		t.Fatalf("Wait() returned %d results, want 7", len(results))
+	}
+
+	var cancelled int
+	for _, r := range results {
+		switch {
+		case r.ID == runningID:
+			// already running when the context fired, so it finishes
+			if !r.Success || r.Cancelled {
+				t.Errorf("running task: %+v, want it to finish successfully", r)
+			}
+		case r.Cancelled:
+			cancelled++
+			if r.Success || !errors.Is(r.Err, context.Canceled) {
+				t.Errorf("cancelled task: %+v, want a failure with context.Canceled", r)
+			}
+		case !r.Success:
+			t.Errorf("unbound task failed: %v", r.Err)
+		}
+	}
+	if cancelled != 5 {
+		t.Errorf("%d tasks cancelled, want 5", cancelled)
+	}
+}
+
+func TestWaitContext(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  func() (context.Context, context.CancelFunc)
+		want error
+	}{
+		{"timeout", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 20*time.Millisecond)
+		}, context.DeadlineExceeded},
+		{"cancel", func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(20*time.Millisecond, cancel)
+			return ctx, cancel
+		}, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(WithMaxConcurrency(2))
+			p.Run(func() error { return nil })
+			release := make(chan struct{})
+			p.Run(func() error { <-release; return nil })
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			results, err := p.WaitContext(ctx)
+			if err != tt.want {
+				t.Fatalf("WaitContext() error = %v, want %v", err, tt.want)
+			}
+			if len(results) != 1 || !results[0].Success {
+				t.Fatalf("WaitContext() = %+v, want the one finished result", results)
+			}
+
+			// the pool is left running, and a later Wait collects the rest
+			close(release)
+			if rest := p.Wait(); len(rest) != 1 {
+				t.Fatalf("Wait() after WaitContext returned %d results, want 1", len(rest))
+			}
+		})
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	p := New(WithMaxConcurrency(3))
+	for i := 0; i < 10; i++ {
+		p.Run(func() error {
+			if i%2 == 0 {
+				panic(fmt.Sprintf("boom %d", i))
+			}
+			return nil
+		})
+	}
+
+	results := p.Wait()
+	if len(results) != 10 {
+		t.Fatalf("Wait() returned %d results, want 10", len(results))
+	}
+	var panicked int
+	for _, r := range results {
+		if r.Success {
+			continue
+		}
+		var pe *PanicError
+		if !errors.As(r.Err, &pe) {
+			t.Fatalf("failed task has Err %v, want a *PanicError", r.Err)
+		}
+		panicked++
+		if pe.Value != fmt.Sprintf("boom %d", r.Index) {
+			t.Errorf("PanicError.Value = %v, want the value passed to panic", pe.Value)
+		}
+		if !strings.Contains(string(pe.Stack), "TestPanicRecovery") {
+			t.Errorf("PanicError.Stack doesn't include the panicking function:\n%s", pe.Stack)
+		}
+		if msg := pe.Error(); !strings.HasPrefix(msg, "panic: boom") || !strings.Contains(msg, "\n") {
+			t.Errorf("PanicError.Error() = %q, want \"panic: <value>\\n<stack>\"", msg)
+		}
+	}
+	if panicked != 5 {
+		t.Errorf("%d tasks reported a panic, want 5", panicked)
+	}
+}
+
+func TestTaskIDs(t *testing.T) {
+	p := New(WithMaxConcurrency(3))
+	for batch := 0; batch < 2; batch++ {
+		ids := make(map[uint64]bool)
+		var last uint64
+		for i := 0; i < 100; i++ {
+			id := p.Run(func() error { return nil })
+			if id != last+1 {
+				t.Fatalf("batch %d: Run() = %d after %d, want IDs increasing by one from 1", batch, id, last)
+			}
+			last = id
+			ids[id] = true
+		}
+
+		for _, r := range p.Wait() {
+			if !ids[r.ID] {
+				t.Fatalf("batch %d: result has ID %d, which Run didn't return or returned twice", batch, r.ID)
+			}
+			delete(ids, r.ID)
+		}
+		if len(ids) != 0 {
+			t.Fatalf("batch %d: no results for IDs %v", batch, ids)
+		}
+
+		// a Reset pool numbers its tasks from 1 again
+		p.Reset()
+	}
+}
+
+func TestCancel(t *testing.T) {
+	p := New(WithMaxConcurrency(2))
+	running := make(chan struct{}, 2)
+	var sawDone atomic.Int32
+	for i := 0; i < 2; i++ {
+		p.RunCancellable(func(done <-chan struct{}) error {
+			running <- struct{}{}
+			<-done
+			sawDone.Add(1)
+			return nil
+		})
+	}
+	for i := 0; i < 10; i++ {
+		p.Run(func() error {
+			t.Error("queued task ran after Cancel")
+			return nil
+		})
+	}
+
+	go func() {
+		<-running
+		<-running
+		p.Cancel()
+		p.Cancel() // a second call does nothing
+	}()
+	results := p.Wait()
+	if len(results) != 12 {
+		t.Fatalf("Wait() returned %d results, want 12", len(results))
+	}
+	var cancelled int
+	for _, r := range results {
+		if r.Cancelled {
+			cancelled++
+			if r.Err != ErrCancelled {
+				t.Errorf("cancelled task has Err %v, want ErrCancelled", r.Err)
+			}
+		} else if !r.Success {
+			t.Errorf("running task failed: %v", r.Err)
+		}
+	}
+	if cancelled != 10 {
+		t.Errorf("%d tasks cancelled, want the 10 queued ones", cancelled)
+	}
+	if sawDone.Load() != 2 {
+		t.Errorf("%d running tasks saw the done channel close, want 2", sawDone.Load())
+	}
+}
+
+func TestCancelZeroValuePool(t *testing.T) {
+	var p Pool
+	running := make(chan struct{})
+	p.RunCancellable(func(done <-chan struct{}) error {
+		close(running)
+		select {
+		case <-done:
+			return nil
+		case <-time.After(5 * time.Second):
+			return errors.New("done channel never closed")
+		}
+	})
+	go func() {
+		<-running
+		p.Cancel()
+	}()
+	results := p.Wait()
+	if len(results) != 1 || !results[0].Success {
+		t.Fatalf("Wait() = %+v, want one success", results)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	p := New(WithMaxConcurrency(2))
+	p.Pause()
+	var started atomic.Int32
+	for i := 0; i < 10; i++ {
+		p.Run(func() error {
+			started.Add(1)
+			return nil
+		})
+	}
+
+	done := make(chan []TaskResult)
+	go func() { done <- p.Wait() }()
+	time.Sleep(30 * time.Millisecond)
+	if n := started.Load(); n != 0 {
+		t.Fatalf("%d tasks started while paused", n)
+	}
+	if n := p.Pending(); n != 10 {
+		t.Fatalf("Pending() = %d while paused, want 10", n)
+	}
+
+	p.Resume()
+	select {
+	case results := <-done:
+		if len(results) != 10 || started.Load() != 10 {
+			t.Fatalf("Wait() returned %d results with %d tasks run, want 10", len(results), started.Load())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("tasks did not run after Resume")
+	}
+}
+
+func TestSetMaxConcurrency(t *testing.T) {
+	p := New(WithMaxConcurrency(1))
+	var active, peak atomic.Int32
+	task := func() error {
+		n := active.Add(1)
+		for old := peak.Load(); n > old && !peak.CompareAndSwap(old, n); old = peak.Load() {
+		}
+		time.Sleep(50 * time.Microsecond)
+		active.Add(-1)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			n := 1 + i%50
+			p.SetMaxConcurrency(n)
+			if got := p.MaxConcurrency(); got != n {
+				t.Errorf("MaxConcurrency() = %d after SetMaxConcurrency(%d)", got, n)
+			}
+			time.Sleep(100 * time.Microsecond)
+		}
+	}()
+	release := p.Hold()
+	go func() {
+		defer wg.Done()
+		defer release()
+		for i := 0; i < 2000; i++ {
+			p.Run(task)
+		}
+	}()
+
+	done := make(chan []TaskResult)
+	go func() { done <- p.Wait() }()
+	select {
+	case results := <-done:
+		if len(results) != 2000 {
+			t.Fatalf("Wait() returned %d results, want 2000", len(results))
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("pool deadlocked while its concurrency changed")
+	}
+	wg.Wait()
+	if n := peak.Load(); n > 50 {
+		t.Fatalf("%d tasks ran at once, above the highest limit of 50", n)
+	}
+}
+
+func TestRunWithTimeout(t *testing.T) {
+	hang := make(chan struct{})
+	defer close(hang)
+
+	p := NewSimple(1)
+	timedOut := p.RunWithTimeout(20*time.Millisecond, func() error { <-hang; return nil })
+	fast := p.RunWithTimeout(time.Second, func() error { return nil })
+	after := p.Run(func() error { return nil })
+
+	done := make(chan map[uint64]TaskResult)
+	go func() { done <- p.WaitMap() }()
+	var results map[uint64]TaskResult
+	select {
+	case results = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a hung task blocked the pool")
+	}
+	if r := results[timedOut]; r.Success || !errors.Is(r.Err, ErrTimeout) {
+		t.Errorf("hung task: got %+v, want ErrTimeout", r)
+	}
+	for _, id := range []uint64{fast, after} {
+		if r := results[id]; !r.Success {
+			t.Errorf("task %d: got %+v, want success", id, r)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	errFailed := errors.New("failed")
+	p := NewSimple(2)
+	start := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		p.Run(func() error {
+			<-start
+			if i < 3 {
+				return errFailed
+			}
+			return nil
+		})
+	}
+	if s := p.Stats(); s.CurrentPending != 10 || s.CurrentRunning != 0 || s.Submitted != 10 {
+		t.Fatalf("before Wait: got %+v, want 10 pending", s)
+	}
+
+	done := make(chan struct{})
+	go func() { p.Wait(); close(done) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Running() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Running() = %d, want 2", p.Running())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if s := p.Stats(); s.CurrentRunning != 2 || s.CurrentPending != 8 || p.Pending() != 8 {
+		t.Errorf("during Wait: got %+v, want 2 running and 8 pending", s)
+	}
+	close(start)
+	<-done
+
+	s := p.Stats()
+	if s.Completed != 7 || s.Failed != 3 || s.CurrentRunning != 0 || s.CurrentPending != 0 {
+		t.Fatalf("after Wait: got %+v, want 7 completed, 3 failed", s)
+	}
+}
+
+func TestTaskDuration(t *testing.T) {
+	const sleep = 30 * time.Millisecond
+	p := NewSimple(2)
+	before := time.Now()
+	p.Run(func() error { time.Sleep(sleep); return nil })
+	r := p.Wait()[0]
+
+	if r.StartedAt.Before(before) {
+		t.Errorf("StartedAt = %v, before the task was submitted at %v", r.StartedAt, before)
+	}
+	if r.Duration < sleep || r.Duration > 2*sleep {
+		t.Errorf("Duration = %v, want about %v", r.Duration, sleep)
+	}
+	if !r.Slow(sleep/2) || r.Slow(4*sleep) {
+		t.Errorf("Slow() disagrees with Duration %v", r.Duration)
+	}
+
+	var zero TaskResult
+	if zero.Duration != 0 || zero.Slow(0) {
+		t.Errorf("zero TaskResult has Duration %v", zero.Duration)
+	}
+}
+
+func TestReset(t *testing.T) {
+	p := NewSimple(2)
+	for batch := 0; batch < 3; batch++ {
+		var ran atomic.Int32
+		for i := 0; i < 10; i++ {
+			p.Run(func() error { ran.Add(1); return nil })
+		}
+		if results := p.Wait(); len(results) != 10 || ran.Load() != 10 {
+			t.Fatalf("batch %d: got %d results from %d runs, want 10", batch, len(results), ran.Load())
+		}
+		if s := p.Stats(); s.Submitted != 10 || s.Completed != 10 {
+			t.Fatalf("batch %d: got %+v, want counters for this batch only", batch, s)
+		}
+		p.Reset()
+	}
+}
+
+func TestResetWhileRunning(t *testing.T) {
+	p := NewSimple(1)
+	release := make(chan struct{})
+	p.Run(func() error { <-release; return nil })
+	done := make(chan struct{})
+	go func() { p.Wait(); close(done) }()
+	for p.Running() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Reset did not panic while a task was running")
+			}
+		}()
+		p.Reset()
+	}()
+	close(release)
+	<-done
+}
+
+func TestRunAll(t *testing.T) {
+	p := NewSimple(4)
+	var ran atomic.Int32
+	tasks := make([]func() error, 1000)
+	for i := range tasks {
+		tasks[i] = func() error { ran.Add(1); return nil }
+	}
+	p.RunAll(tasks)
+	p.RunMany(tasks[:5]...)
+
+	results := p.WaitOrdered()
+	if len(results) != 1005 || ran.Load() != 1005 {
+		t.Fatalf("got %d results from %d runs, want 1005", len(results), ran.Load())
+	}
+	for i, r := range results {
+		if r.ID != uint64(i+1) {
+			t.Fatalf("result %d has ID %d, want IDs in submission order", i, r.ID)
+		}
+	}
+}
+
+// BenchmarkSubmit measures submission alone; draining the pool between
+// iterations is left out of the timing.
+func BenchmarkSubmit(b *testing.B) {
+	tasks := make([]func() error, 10000)
+	for i := range tasks {
+		tasks[i] = func() error { return nil }
+	}
+	b.Run("Run", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			p := NewSimple(8)
+			for _, task := range tasks {
+				p.Run(task)
+			}
+			b.StopTimer()
+			p.Wait()
+			b.StartTimer()
+		}
+	})
+	b.Run("RunAll", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			p := NewSimple(8)
+			p.RunAll(tasks)
+			b.StopTimer()
+			p.Wait()
+			b.StartTimer()
+		}
+	})
+}
+
+func TestResults(t *testing.T) {
+	p := NewSimple(3)
+	release := p.Hold()
+	results := p.Results()
+
+	go func() {
+		defer release()
+		for i := 0; i < 50; i++ {
+			p.Run(func() error { time.Sleep(100 * time.Microsecond); return nil })
+		}
+	}()
+
+	seen := make(map[uint64]bool)
+	for r := range results {
+		if seen[r.ID] {
+			t.Fatalf("task %d delivered twice", r.ID)
+		}
+		seen[r.ID] = true
+	}
+	if len(seen) != 50 {
+		t.Fatalf("received %d results, want 50", len(seen))
+	}
+	if r := p.Wait(); r != nil {
+		t.Fatalf("Wait() after Results() = %v, want nil", r)
+	}
+	if p.Results() != results {
+		t.Fatal("Results() returned a different channel on the second call")
+	}
+}
+
+func TestFailFast(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name          string
+		opts          []Option
+		failures      int32 // times task 5 fails before it succeeds
+		wantRan       int
+		wantCancelled int
+	}{
+		{"stops at the failure", nil, 1, 5, 95},
+		{"stops once retries are exhausted", []Option{WithRetry(3)}, 3, 5, 95},
+		{"keeps going when a retry succeeds", []Option{WithRetry(3)}, 2, 100, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(append([]Option{WithMaxConcurrency(1), WithFailFast()}, tt.opts...)...)
+			var ran [101]atomic.Bool
+			var failures atomic.Int32
+			for i := 1; i <= 100; i++ {
+				p.Run(func() error {
+					ran[i].Store(true)
+					if i == 5 && failures.Add(1) <= tt.failures {
+						return errFailed
+					}
+					return nil
+				})
+			}
+			results := p.Wait()
+
+			nran, cancelled := 0, 0
+			for i := range ran {
+				if ran[i].Load() {
+					nran++
+				}
+			}
+			for _, r := range results {
+				if r.Cancelled {
+					cancelled++
+				}
+			}
+			if len(results) != 100 || cancelled != tt.wantCancelled {
+				t.Fatalf("got %d results with %d cancelled, want 100 with %d", len(results), cancelled, tt.wantCancelled)
+			}
+			if nran != tt.wantRan {
+				t.Fatalf("%d tasks ran, want %d", nran, tt.wantRan)
+			}
+		})
+	}
+}
+
+func TestOnComplete(t *testing.T) {
+	errFailed := errors.New("failed")
+	p := NewSimple(3)
+	var completed, failed atomic.Int32
+	p.OnComplete(func(TaskResult) { t.Error("replaced OnComplete callback was called") })
+	p.OnComplete(func(TaskResult) { completed.Add(1) })
+	p.OnError(func(r TaskResult) {
+		if r.Success {
+			t.Errorf("OnError called for successful task %d", r.ID)
+		}
+		failed.Add(1)
+	})
+	for i := 0; i < 10; i++ {
+		p.Run(func() error {
+			if i == 3 {
+				return errFailed
+			}
+			return nil
+		})
+	}
+	p.Wait()
+	if completed.Load() != 10 || failed.Load() != 1 {
+		t.Fatalf("OnComplete called %d times and OnError %d, want 10 and 1", completed.Load(), failed.Load())
+	}
+}
+
+func TestStatsCounters(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name string
+		opts []Option
+		want PoolStats
+	}{
+		{"all run", nil, PoolStats{Submitted: 20, Started: 20, Completed: 19, Failed: 1}},
+		{"fail fast", []Option{WithFailFast()}, PoolStats{Submitted: 20, Started: 5, Completed: 4, Failed: 1, Cancelled: 15}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(append([]Option{WithMaxConcurrency(1)}, tt.opts...)...)
+			for i := 0; i < 20; i++ {
+				p.Run(func() error {
+					if i == 4 {
+						return errFailed
+					}
+					return nil
+				})
+			}
+			p.Wait()
+
+			s := p.Stats()
+			if s.Submitted != tt.want.Submitted || s.Started != tt.want.Started || s.Completed != tt.want.Completed ||
+				s.Failed != tt.want.Failed || s.Cancelled != tt.want.Cancelled {
+				t.Fatalf("got %+v, want %+v", s, tt.want)
+			}
+			if s.Submitted != s.Completed+s.Failed+s.Cancelled || s.Started != s.Completed+s.Failed {
+				t.Fatalf("counters do not add up: %+v", s)
+			}
+
+			data, err := json.Marshal(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded PoolStats
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if decoded != s {
+				t.Fatalf("JSON round trip: got %+v, want %+v", decoded, s)
+			}
+		})
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	t.Run("finishes in time", func(t *testing.T) {
+		p := NewSimple(2)
+		for i := 0; i < 5; i++ {
+			p.Run(func() error { time.Sleep(time.Millisecond); return nil })
+		}
+		results, err := p.Shutdown(context.Background())
+		if err != nil || len(results) != 5 {
+			t.Fatalf("Shutdown() = %d results, %v; want 5, nil", len(results), err)
+		}
+	})
+
+	t.Run("deadline passes", func(t *testing.T) {
+		hang := make(chan struct{})
+		defer close(hang)
+
+		p := NewSimple(2)
+		fast := p.Run(func() error { time.Sleep(10 * time.Millisecond); return nil })
+		for i := 0; i < 6; i++ {
+			p.Run(func() error { <-hang; return nil })
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		results, err := p.Shutdown(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Shutdown() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("Shutdown took %v after its deadline", elapsed)
+		}
+		if len(results) != 7 {
+			t.Fatalf("Shutdown() returned %d results, want 7", len(results))
+		}
+		// the fast task frees a slot for one queued task, which hangs too
+		timedOut, cancelled := 0, 0
+		for _, r := range results {
+			switch {
+			case r.ID == fast:
+				if !r.Success {
+					t.Errorf("fast task: got %+v, want success", r)
+				}
+			case errors.Is(r.Err, ErrTimeout):
+				timedOut++
+			case r.Cancelled:
+				cancelled++
+			}
+		}
+		if timedOut != 2 || cancelled != 4 {
+			t.Errorf("got %d timed out and %d cancelled, want 2 and 4", timedOut, cancelled)
+		}
+
+		defer func() {
+			if recover() == nil {
+				t.Error("Run after Shutdown did not panic")
+			}
+		}()
+		p.Run(func() error { return nil })
+	})
+}
+
+func TestRunNamed(t *testing.T) {
+	errDial := errors.New("dial timeout")
+	p := NewSimple(3)
+	for i := 0; i < 10; i++ {
+		p.RunNamed(fmt.Sprintf("fetch-user-%d", i), func() error {
+			if i == 7 {
+				return errDial
+			}
+			return nil
+		})
+	}
+	unnamed := p.Run(func() error { return nil })
+
+	results := p.Wait()
+	if len(results) != 11 {
+		t.Fatalf("got %d results, want 11", len(results))
+	}
+	for _, r := range results {
+		if r.ID == unnamed {
+			if r.Name != "" {
+				t.Errorf("task submitted with Run has Name %q", r.Name)
+			}
+			continue
+		}
+		if want := fmt.Sprintf("fetch-user-%d", r.ID-1); r.Name != want {
+			t.Errorf("task %d: Name = %q, want %q", r.ID, r.Name, want)
+		}
+		if r.Success == (r.Name == "fetch-user-7") {
+			t.Errorf("task %q: Success = %v", r.Name, r.Success)
+		}
+	}
+}
+
+func TestNamedTaskErrors(t *testing.T) {
+	errDial := errors.New("dial timeout")
+	p := New(WithMaxConcurrency(2), WithRetry(2))
+	p.RunNamed("fetch-user-123", func() error { return errDial })
+	p.RunNamed("parse-user-123", func() error { panic("bad input") })
+	for _, r := range p.Wait() {
+		if !strings.HasPrefix(r.Err.Error(), fmt.Sprintf("task %q: ", r.Name)) {
+			t.Errorf("error %q does not name task %q", r.Err, r.Name)
+		}
+	}
+}
+
+func TestWaitOrdered(t *testing.T) {
+	const n = 10
+	p := NewSimple(n)
+	for i := 0; i < n; i++ {
+		// later tasks finish first
+		p.Run(func() error { time.Sleep(time.Duration(n-i) * 5 * time.Millisecond); return nil })
+	}
+	results := p.WaitOrdered()
+	if len(results) != n {
+		t.Fatalf("got %d results, want %d", len(results), n)
+	}
+	for i, r := range results {
+		if r.Index != i || r.ID != uint64(i+1) {
+			t.Fatalf("results[%d] has Index %d and ID %d", i, r.Index, r.ID)
+		}
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	p := NewSimple(2)
+	var discarded int
+	p.OnDiscard(func(n int) { discarded = n })
+	var ran atomic.Int32
+	for i := 0; i < 10; i++ {
+		p.Run(func() error { ran.Add(1); return nil })
+	}
+
+	if n := p.Discard(); n != 10 || discarded != 10 {
+		t.Fatalf("Discard() = %d and OnDiscard got %d, want 10", n, discarded)
+	}
+	if results := p.Wait(); len(results) != 0 || ran.Load() != 0 {
+		t.Fatalf("Wait() returned %d results after %d runs, want none", len(results), ran.Load())
+	}
+	if s := p.Stats(); s.Cancelled != 10 {
+		t.Fatalf("Stats().Cancelled = %d, want 10", s.Cancelled)
+	}
+}
+
+func TestWaitWithTimeout(t *testing.T) {
+	release := make(chan struct{})
+	p := NewSimple(2)
+	p.Run(func() error { return nil })
+	slow := p.Run(func() error { <-release; return nil })
+
+	results, timedOut := p.WaitWithTimeout(50 * time.Millisecond)
+	if !timedOut || len(results) != 1 || results[0].ID == slow {
+		t.Fatalf("WaitWithTimeout() = %+v, %v; want the fast result and a timeout", results, timedOut)
+	}
+
+	// the pool was not cancelled: the slow task still finishes
+	close(release)
+	results, timedOut = p.WaitWithTimeout(5 * time.Second)
+	if timedOut || len(results) != 1 || results[0].ID != slow || !results[0].Success {
+		t.Fatalf("second WaitWithTimeout() = %+v, %v; want the slow result", results, timedOut)
+	}
+}
+
+func TestRunN(t *testing.T) {
+	p := NewSimple(4)
+	var calls atomic.Int32
+	p.RunN(10, func() error { calls.Add(1); return nil })
+
+	results := p.Wait()
+	if len(results) != 10 || calls.Load() != 10 {
+		t.Fatalf("got %d results from %d calls, want 10", len(results), calls.Load())
+	}
+	ids := make(map[uint64]bool)
+	for _, r := range results {
+		if !r.Success {
+			t.Errorf("copy %d failed: %v", r.ID, r.Err)
+		}
+		ids[r.ID] = true
+	}
+	if len(ids) != 10 {
+		t.Fatalf("10 copies produced %d distinct IDs", len(ids))
+	}
+}
+
+func TestWaitFirst(t *testing.T) {
+	p := NewSimple(10)
+	delays := []int{50, 30, 80, 10, 60, 90, 40, 70, 20, 100}
+	var fastest uint64
+	for _, ms := range delays {
+		id := p.Run(func() error { time.Sleep(time.Duration(ms) * time.Millisecond); return nil })
+		if ms == 10 {
+			fastest = id
+		}
+	}
+	if r := p.WaitFirst(); r.ID != fastest || !r.Success {
+		t.Fatalf("WaitFirst() = %+v, want the result of task %d", r, fastest)
+	}
+	if r := p.Wait(); len(r) != 0 {
+		t.Fatalf("Wait() after WaitFirst returned %d discarded results", len(r))
+	}
+	p.Reset()
+	p.Run(func() error { return nil })
+	if r := p.WaitFirstN(3); len(r) != 1 {
+		t.Fatalf("WaitFirstN(3) with one task returned %d results, want 1", len(r))
+	}
+	if r := (&Pool{}).WaitFirst(); r.ID != 0 {
+		t.Fatalf("WaitFirst() on an empty pool = %+v, want the zero TaskResult", r)
+	}
+}
+
+func TestWaitN(t *testing.T) {
+	p := NewSimple(1)
+	var ran atomic.Int32
+	for i := 0; i < 10; i++ {
+		p.Run(func() error { ran.Add(1); time.Sleep(time.Millisecond); return nil })
+	}
+	results := p.WaitN(3)
+	if len(results) != 3 {
+		t.Fatalf("WaitN(3) returned %d results", len(results))
+	}
+	for i, r := range results {
+		if r.ID != uint64(i+1) || !r.Success {
+			t.Errorf("results[%d] = %+v, want task %d", i, r, i+1)
+		}
+	}
+	p.Wait()
+	if n := ran.Load(); n > 4 {
+		t.Fatalf("%d tasks ran, want the 3 needed plus at most the one running", n)
+	}
+	if s := p.Stats(); s.Cancelled < 6 {
+		t.Fatalf("Stats().Cancelled = %d, want the queued tasks cancelled", s.Cancelled)
+	}
+}
+
+func TestWaitNWithConcurrentRun(t *testing.T) {
+	p := NewSimple(2)
+	release := p.Hold()
+	go func() {
+		defer release()
+		for i := 0; i < 5; i++ {
+			p.Run(func() error { return nil })
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	if results := p.WaitN(3); len(results) != 3 {
+		t.Fatalf("WaitN(3) returned %d results", len(results))
+	}
+}
+
+func TestForEachResult(t *testing.T) {
+	errOdd := errors.New("odd")
+	submit := func(p *Pool) {
+		for i := 0; i < 50; i++ {
+			p.Run(func() error {
+				if i%2 == 1 {
+					return errOdd
+				}
+				return nil
+			})
+		}
+	}
+
+	var got []TaskResult
+	each := NewSimple(4)
+	submit(each)
+	waited := NewSimple(4)
+	submit(waited)
+	done := make(chan []TaskResult)
+	go func() { done <- waited.WaitOrdered() }()
+	each.ForEachResult(func(r TaskResult) { got = append(got, r) })
+	want := <-done
+
+	if len(got) != len(want) {
+		t.Fatalf("ForEachResult saw %d results, Wait returned %d", len(got), len(want))
+	}
+	slices.SortFunc(got, func(a, b TaskResult) int { return cmp.Compare(a.ID, b.ID) })
+	for i := range want {
+		if got[i].ID != want[i].ID || got[i].Success != want[i].Success || got[i].Err != want[i].Err {
+			t.Fatalf("result %d: ForEachResult saw %+v, Wait returned %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestForEachResultContext(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	p := NewSimple(1)
+	p.Run(func() error { return nil })
+	p.Run(func() error { <-release; return nil })
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	n := 0
+	err := p.ForEachResultContext(ctx, func(TaskResult) { n++ })
+	if !errors.Is(err, context.DeadlineExceeded) || n != 1 {
+		t.Fatalf("ForEachResultContext() = %v after %d results, want %v after 1", err, n, context.DeadlineExceeded)
+	}
+}
+
+func TestOnIdle(t *testing.T) {
+	p := NewSimple(2)
+	var finished atomic.Int32
+	for i := 0; i < 20; i++ {
+		p.Run(func() error { time.Sleep(time.Millisecond); finished.Add(1); return nil })
+	}
+	idle := make(chan int32, 2)
+	p.OnIdle(func() { t.Error("replaced OnIdle callback was called") })
+	p.OnIdle(func() { idle <- finished.Load() })
+	select {
+	case <-idle:
+		t.Fatal("OnIdle fired while tasks were queued")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	p.Wait()
+	if n := <-idle; n != 20 {
+		t.Fatalf("OnIdle fired after %d of 20 tasks", n)
+	}
+	select {
+	case <-idle:
+		t.Fatal("OnIdle fired twice")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestOnIdleWhenIdle(t *testing.T) {
+	p := NewSimple(1)
+	idle := make(chan struct{})
+	p.OnIdle(func() { close(idle) })
+	select {
+	case <-idle:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnIdle did not fire for an idle pool")
+	}
+}
+
+func TestOnIdleAfterResume(t *testing.T) {
+	p := NewSimple(1)
+	var fired atomic.Int32
+	p.Run(func() error { return nil })
+	p.OnIdle(func() { fired.Add(1) })
+	p.Wait()
+
+	p.Reset()
+	p.Pause()
+	p.Run(func() error { return nil })
+	p.Resume()
+	p.Wait()
+	deadline := time.Now().Add(5 * time.Second)
+	for fired.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := fired.Load(); n != 2 {
+		t.Fatalf("OnIdle fired %d times, want once per batch after Resume", n)
+	}
+}
+
+func TestRunBounded(t *testing.T) {
+	p := New(WithMaxConcurrency(1), WithMaxQueue(2))
+	for i := 0; i < 2; i++ {
+		if !p.TryRun(func() error { return nil }) {
+			t.Fatalf("TryRun %d failed with room in the queue", i)
+		}
+	}
+	if p.TryRun(func() error { return nil }) {
+		t.Fatal("TryRun succeeded on a full queue")
+	}
+
+	const maxWait = 50 * time.Millisecond
+	start := time.Now()
+	err := p.RunBounded(maxWait, func() error { return nil })
+	if elapsed := time.Since(start); !errors.Is(err, ErrQueueFull) || elapsed < maxWait || elapsed > 4*maxWait {
+		t.Fatalf("RunBounded() = %v after %v, want ErrQueueFull after about %v", err, elapsed, maxWait)
+	}
+
+	// room made by waiting on the pool lets a blocked producer through
+	release := p.Hold()
+	done := make(chan []TaskResult)
+	go func() { done <- p.Wait() }()
+	if err := p.RunBounded(5*time.Second, func() error { return nil }); err != nil {
+		t.Fatalf("RunBounded() = %v while the pool drained", err)
+	}
+	release()
+	if results := <-done; len(results) != 3 {
+		t.Fatalf("got %d results, want the 3 accepted tasks", len(results))
+	}
+}
+
+func TestMaxFailures(t *testing.T) {
+	errFailed := errors.New("failed")
+	p := New(WithMaxConcurrency(1), WithMaxFailures(3))
+	var ran [11]atomic.Bool
+	for i := 1; i <= 10; i++ {
+		p.Run(func() error {
+			ran[i].Store(true)
+			if i == 2 || i == 5 || i == 8 {
+				return errFailed
+			}
+			return nil
+		})
+	}
+	results := p.Wait()
+
+	for i := 1; i <= 10; i++ {
+		if ran[i].Load() != (i <= 8) {
+			t.Errorf("task %d ran = %v, want the pool to stop after task 8", i, ran[i].Load())
+		}
+	}
+	// ten task results plus the one saying why the batch stopped
+	if len(results) != 11 {
+		t.Fatalf("got %d results, want 11", len(results))
+	}
+	exceeded, cancelled := 0, 0
+	for _, r := range results {
+		switch {
+		case errors.Is(r.Err, ErrMaxFailuresExceeded):
+			exceeded++
+			if r.ID != 0 || r.Index != -1 {
+				t.Errorf("ErrMaxFailuresExceeded result = %+v, want ID 0 and Index -1", r)
+			}
+		case r.Cancelled:
+			cancelled++
+		}
+	}
+	if exceeded != 1 || cancelled != 2 {
+		t.Fatalf("got %d ErrMaxFailuresExceeded and %d cancelled results, want 1 and 2", exceeded, cancelled)
+	}
+	if s := p.Stats(); s.FailureCount != 3 {
+		t.Fatalf("Stats().FailureCount = %d, want 3", s.FailureCount)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	p := NewSimple(4)
+	const total = 200
+	produced := make(chan struct{})
+	go func() {
+		defer close(produced)
+		for i := 0; i < total; i++ {
+			p.Run(func() error { time.Sleep(100 * time.Microsecond); return nil })
+			time.Sleep(50 * time.Microsecond)
+		}
+	}()
+
+	seen := make(map[uint64]bool)
+	for flushes := 0; len(seen) < total; flushes++ {
+		if flushes > 1000 {
+			t.Fatalf("collected %d of %d results after %d flushes", len(seen), total, flushes)
+		}
+		for _, r := range p.Flush() {
+			if seen[r.ID] {
+				t.Fatalf("task %d flushed twice", r.ID)
+			}
+			seen[r.ID] = true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	<-produced
+
+	// Flush didn't end the batch: the pool still accepts work
+	p.Run(func() error { return nil })
+	if results := p.Wait(); len(results) != 1 {
+		t.Fatalf("Wait() after flushing returned %d results, want 1", len(results))
+	}
+}
+
+var _ io.Closer = (*Pool)(nil)
+
+func TestClose(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name    string
+		tasks   []func() error
+		wantErr bool
+	}{
+		{"all succeed", []func() error{func() error { return nil }, func() error { return nil }}, false},
+		{"one fails", []func() error{func() error { return nil }, func() error { return errFailed }}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ran atomic.Int32
+			err := func() (err error) {
+				p := NewSimple(2)
+				defer func() { err = p.Close() }()
+				for _, task := range tt.tasks {
+					p.Run(func() error { ran.Add(1); return task() })
+				}
+				return nil
+			}()
+			if ran.Load() != int32(len(tt.tasks)) {
+				t.Fatalf("deferred Close returned after %d of %d tasks ran", ran.Load(), len(tt.tasks))
+			}
+			var me *MultiError
+			if tt.wantErr != errors.As(err, &me) || tt.wantErr && !errors.Is(err, errFailed) {
+				t.Fatalf("Close() = %v, want error: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("Close() = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestCloseAfterWait(t *testing.T) {
+	p := NewSimple(1)
+	p.Run(func() error { return errors.New("failed") })
+	p.Wait()
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close() after Wait = %v, want nil", err)
+	}
+}
+
+func TestDefer(t *testing.T) {
+	p := NewSimple(4)
+	var mu sync.Mutex
+	var order []string
+	record := func(s string) func() error {
+		return func() error {
+			mu.Lock()
+			order = append(order, s)
+			mu.Unlock()
+			return nil
+		}
+	}
+	p.Defer(record("first deferred"))
+	for i := 0; i < 8; i++ {
+		p.Run(record("task"))
+	}
+	p.Defer(record("second deferred"))
+	p.Defer(record("third deferred"))
+
+	results := p.Wait()
+	if len(results) != 11 {
+		t.Fatalf("got %d results, want 11", len(results))
+	}
+	want := []string{"third deferred", "second deferred", "first deferred"}
+	if got := order[8:]; !slices.Equal(got, want) {
+		t.Fatalf("deferred tasks ran in order %v, want %v", got, want)
+	}
+	for i, r := range results {
+		if r.Deferred != (i >= 8) {
+			t.Fatalf("results[%d].Deferred = %v, want deferred results last", i, r.Deferred)
+		}
+	}
+}
+
+func TestDeferRunsSerially(t *testing.T) {
+	p := NewSimple(4)
+	var running, peak atomic.Int32
+	for i := 0; i < 5; i++ {
+		p.Defer(func() error {
+			n := running.Add(1)
+			peak.Store(max(peak.Load(), n))
+			time.Sleep(time.Millisecond)
+			running.Add(-1)
+			return nil
+		})
+	}
+	p.Wait()
+	if peak.Load() != 1 {
+		t.Fatalf("%d deferred tasks ran at once, want 1", peak.Load())
+	}
+}
+
+func TestRunFromChannel(t *testing.T) {
+	p := NewSimple(4)
+	ch := make(chan func() error)
+	fed := p.RunFromChannel(ch)
+	go func() {
+		defer close(ch)
+		for i := 0; i < 1000; i++ {
+			ch <- func() error { return nil }
+		}
+	}()
+
+	if results := p.Wait(); len(results) != 1000 {
+		t.Fatalf("got %d results, want 1000", len(results))
+	}
+	select {
+	case <-fed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunFromChannel's done channel was not closed after ch was")
+	}
+}
+
+func TestRunFromChannelCancelled(t *testing.T) {
+	p := NewSimple(1)
+	ch := make(chan func() error)
+	fed := p.RunFromChannel(ch)
+	ch <- func() error { return nil }
+	p.Cancel()
+	select {
+	case <-fed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunFromChannel kept reading after the pool was cancelled")
+	}
+	p.Wait()
+}
+
+func TestWaitMap(t *testing.T) {
+	p := NewSimple(3)
+	ids := make(map[uint64]bool)
+	for i := 0; i < 25; i++ {
+		ids[p.Run(func() error { return nil })] = true
+	}
+	results := p.WaitMap()
+	if len(results) != len(ids) {
+		t.Fatalf("WaitMap() has %d keys, want %d", len(results), len(ids))
+	}
+	for id, r := range results {
+		if !ids[id] || r.ID != id {
+			t.Fatalf("WaitMap() has key %d for task %d, which was not submitted", id, r.ID)
+		}
+	}
+}
+
+func TestWaitMapNamed(t *testing.T) {
+	p := NewSimple(3)
+	names := []string{"alpha", "beta", "gamma"}
+	for _, name := range names {
+		p.RunNamed(name, func() error { return nil })
+	}
+	p.Run(func() error { return nil })
+	results := p.WaitMapNamed()
+	if len(results) != len(names) {
+		t.Fatalf("WaitMapNamed() has %d keys, want %d named tasks", len(results), len(names))
+	}
+	for _, name := range names {
+		if r, ok := results[name]; !ok || r.Name != name {
+			t.Errorf("WaitMapNamed()[%q] = %+v, %v", name, r, ok)
+		}
+	}
+}
+
+func TestWithPanicHandler(t *testing.T) {
+	errSentinel := errors.New("task panicked")
+	tests := []struct {
+		name        string
+		handler     func(any) error
+		wantSuccess bool
+		check       func(t *testing.T, err error)
+	}{
+		{
+			name:    "returns an error",
+			handler: func(v any) error { return fmt.Errorf("%w: %v", errSentinel, v) },
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, errSentinel) || !strings.Contains(err.Error(), "boom") {
+					t.Errorf("Err = %v, want the handler's error", err)
+				}
+			},
+		},
+		{
+			name:        "returns nil",
+			handler:     func(any) error { return nil },
+			wantSuccess: true,
+		},
+		{
+			name:    "panics again",
+			handler: func(v any) error { panic(v) },
+			check: func(t *testing.T, err error) {
+				var pe *PanicError
+				if !errors.As(err, &pe) || pe.Value != "boom" {
+					t.Errorf("Err = %v, want the fallback *PanicError", err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got any
+			p := New(WithoutPanicRecovery(), WithPanicHandler(func(v any) error {
+				got = v
+				return tt.handler(v)
+			}))
+			p.Run(func() error { panic("boom") })
+			r := p.Wait()[0]
+			if got != "boom" {
+				t.Errorf("handler got %v, want the recovered value", got)
+			}
+			if r.Success != tt.wantSuccess {
+				t.Fatalf("Success = %v, want %v (Err: %v)", r.Success, tt.wantSuccess, r.Err)
+			}
+			if tt.check != nil {
+				tt.check(t, r.Err)
+			}
+		})
+	}
+}
+
+func TestWaitAccumulate(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name  string
+		tasks []func() error
+		is    []error
+	}{
+		{
+			name:  "all succeed",
+			tasks: []func() error{func() error { return nil }, func() error { return nil }},
+		},
+		{
+			name: "one wraps io.EOF",
+			tasks: []func() error{
+				func() error { return nil },
+				func() error { return fmt.Errorf("read: %w", io.EOF) },
+			},
+			is: []error{io.EOF},
+		},
+		{
+			name: "several failures",
+			tasks: []func() error{
+				func() error { return errFailed },
+				func() error { return nil },
+				func() error { return io.EOF },
+			},
+			is: []error{errFailed, io.EOF},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New()
+			for _, task := range tt.tasks {
+				p.Run(task)
+			}
+			results, err := p.WaitAccumulate()
+			if len(results) != len(tt.tasks) {
+				t.Fatalf("WaitAccumulate() = %d results, want %d", len(results), len(tt.tasks))
+			}
+			if tt.is == nil {
+				if err != nil {
+					t.Fatalf("WaitAccumulate() error = %v, want nil", err)
+				}
+				return
+			}
+			var me *MultiError
+			if !errors.As(err, &me) || len(me.Errors) != len(tt.is) || me.Total != len(tt.tasks) {
+				t.Fatalf("WaitAccumulate() error = %v, want a *MultiError of %d/%d", err, len(tt.is), len(tt.tasks))
+			}
+			for _, target := range tt.is {
+				if !errors.Is(err, target) {
+					t.Errorf("errors.Is(%v, %v) = false, want true", err, target)
+				}
+			}
+		})
+	}
+}
+
+func TestRunWithTTL(t *testing.T) {
+	// the first task holds the only slot for 20ms, past the short TTL
+	p := NewSimple(1)
+	p.Run(func() error { time.Sleep(20 * time.Millisecond); return nil })
+	expired := p.RunWithTTL(10*time.Millisecond, func() error {
+		t.Error("expired task ran")
+		return nil
+	})
+	fresh := p.RunWithTTL(time.Minute, func() error { return nil })
+	plain := p.Run(func() error { return nil })
+	results := p.WaitMap()
+
+	if len(results) != 4 {
+		t.Fatalf("WaitMap() = %d results, want 4", len(results))
+	}
+	if r := results[expired]; !r.Expired || r.Success || !errors.Is(r.Err, ErrTaskExpired) {
+		t.Errorf("expired task: got %+v, want Expired with ErrTaskExpired", r)
+	}
+	for _, id := range []uint64{fresh, plain} {
+		if r := results[id]; !r.Success || r.Expired {
+			t.Errorf("task %d: got %+v, want it to run", id, r)
+		}
+	}
+}
+
+func TestRunIterator(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs a million tasks")
+	}
+	t.Parallel()
+	const total, maxQueue = 1_000_000, 100
+	p := New(WithMaxConcurrency(8), WithMaxQueue(maxQueue))
+	var produced int
+	var peak int
+	var ran atomic.Int64
+	h := p.RunIterator(func() (func() error, bool) {
+		if produced == total {
+			return nil, false
+		}
+		produced++
+		peak = max(peak, p.Pending())
+		return func() error { ran.Add(1); return nil }, true
+	})
+	var results int
+	p.ForEachResult(func(TaskResult) { results++ })
+	<-h.Done()
+
+	if results != total || ran.Load() != total {
+		t.Fatalf("got %d results from %d runs, want %d", results, ran.Load(), total)
+	}
+	if peak > maxQueue {
+		t.Errorf("queue depth peaked at %d, want at most %d", peak, maxQueue)
+	}
+}
+
+func TestRunIteratorCancelled(t *testing.T) {
+	p := New(WithMaxQueue(1))
+	h := p.RunIterator(func() (func() error, bool) {
+		return func() error { time.Sleep(time.Millisecond); return nil }, true
+	})
+	time.AfterFunc(20*time.Millisecond, p.Cancel)
+	p.Wait()
+	select {
+	case <-h.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("iterator kept running after Cancel")
+	}
+}
+
+func TestNewDefault(t *testing.T) {
+	procs := runtime.GOMAXPROCS(0)
+	tests := []struct {
+		name string
+		pool *Pool
+		want int
+	}{
+		{"NewDefault", NewDefault(), procs},
+		{"NewDefaultIO(10)", NewDefaultIO(10), 10 * procs},
+		{"NewDefaultIO(0)", NewDefaultIO(0), procs},
+	}
+	errFailed := errors.New("failed")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.pool
+			if got := p.MaxConcurrency(); got != tt.want {
+				t.Fatalf("MaxConcurrency() = %d, want %d", got, tt.want)
+			}
+			var ran atomic.Int32
+			for i := 0; i < 50; i++ {
+				p.Run(func() error {
+					ran.Add(1)
+					if i%10 == 0 {
+						return errFailed
+					}
+					return nil
+				})
+			}
+			results := p.Wait()
+			if len(results) != 50 || ran.Load() != 50 {
+				t.Fatalf("got %d results from %d runs, want 50", len(results), ran.Load())
+			}
+			if n := len(Errors(results)); n != 5 {
+				t.Errorf("got %d failures, want 5", n)
+			}
+		})
+	}
+}
+
+func TestWaitDrain(t *testing.T) {
+	p := NewSimple(10)
+	release := make(chan struct{})
+	var ran atomic.Int32
+	for i := 0; i < 100; i++ {
+		p.Run(func() error { ran.Add(1); <-release; return nil })
+	}
+	p.Defer(func() error { t.Error("deferred task ran"); return nil })
+	var discarded int
+	p.OnDiscard(func(n int) { discarded = n })
+
+	// shutting down: stop waiting once the pool is at capacity, then drain
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for ran.Load() < 10 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	if _, err := p.WaitContext(ctx); err != context.Canceled {
+		t.Fatalf("WaitContext() error = %v, want context.Canceled", err)
+	}
+	time.AfterFunc(10*time.Millisecond, func() { close(release) })
+	results := p.WaitDrain()
+
+	if len(results) != 10 || ran.Load() != 10 {
+		t.Fatalf("WaitDrain() = %d results from %d runs, want 10", len(results), ran.Load())
+	}
+	if HasErrors(results) {
+		t.Error("a drained task did not complete")
+	}
+	if discarded != 91 {
+		t.Errorf("discarded %d tasks, want the 90 queued ones and the deferred one", discarded)
+	}
+	if s := p.Stats(); s.Completed != 10 || s.Cancelled != 91 {
+		t.Errorf("Stats() = %d completed, %d cancelled, want 10 and 91", s.Completed, s.Cancelled)
+	}
+
+	// terminated until Reset
+	p.Run(func() error { t.Error("task ran before Reset"); return nil })
+	p.Reset()
+	p.Run(func() error { return nil })
+	if results := p.Wait(); len(results) != 1 || !results[0].Success {
+		t.Errorf("after Reset: Wait() = %+v, want one success", results)
+	}
+}
+
+func TestRunWeighted(t *testing.T) {
+	tests := []struct {
+		name          string
+		pool          *Pool
+		lightestFirst bool
+	}{
+		{"NewWeighted", NewWeighted(10), true},
+		{"NewSimple", NewSimple(10), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.pool
+			var mu sync.Mutex
+			var running, peak int
+			var started []int
+			run := func(weight int) func() error {
+				return func() error {
+					mu.Lock()
+					if weight > 10 && running != 0 {
+						t.Errorf("weight %d task started next to %d running units", weight, running)
+					}
+					running += weight
+					if weight <= 10 {
+						peak = max(peak, running)
+					}
+					started = append(started, weight)
+					mu.Unlock()
+					time.Sleep(2 * time.Millisecond)
+					mu.Lock()
+					running -= weight
+					mu.Unlock()
+					return nil
+				}
+			}
+			for i := 0; i < 40; i++ {
+				w := []int{1, 2, 5, 3}[i%4]
+				p.RunWeighted(w, run(w))
+			}
+			// heavier than the whole limit, so it runs on its own
+			p.RunWeighted(50, run(50))
+			p.Run(run(1))
+			results := p.Wait()
+
+			if len(results) != 42 || HasErrors(results) {
+				t.Fatalf("Wait() = %d results, want 42 successes", len(results))
+			}
+			if peak > 10 {
+				t.Errorf("%d weight units ran at once, want at most 10", peak)
+			}
+			if tt.lightestFirst && !slices.Equal(started[:11], slices.Repeat([]int{1}, 11)) {
+				t.Errorf("tasks started in weight order %v, want the 11 weight-1 tasks first", started[:11])
+			}
+		})
+	}
+}
+
+func TestRecursiveSubmission(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"unbounded queue", nil},
+		{"bounded queue", []Option{WithMaxQueue(2)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(append(tt.opts, WithMaxConcurrency(2))...)
+			var ran atomic.Int32
+			// the root submits two tasks, which submit one more each
+			leaf := func() error { ran.Add(1); return nil }
+			mid := func() error { ran.Add(1); p.Run(leaf); return nil }
+			p.Run(func() error { ran.Add(1); p.Run(mid); p.Run(mid); return nil })
+
+			done := make(chan []TaskResult)
+			go func() { done <- p.Wait() }()
+			select {
+			case results := <-done:
+				if len(results) != 5 || HasErrors(results) || ran.Load() != 5 {
+					t.Errorf("Wait() = %d results from %d runs, want 5 successes", len(results), ran.Load())
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Wait() deadlocked")
+			}
+		})
+	}
+}
+
+func TestHold(t *testing.T) {
+	p := NewSimple(2)
+	var ran atomic.Int32
+	p.Run(func() error {
+		// the follow-up is submitted after this task has returned
+		release := p.Hold()
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			p.Run(func() error { ran.Add(1); return nil })
+			release()
+			release()
+		}()
+		return nil
+	})
+	if results := p.Wait(); len(results) != 2 || ran.Load() != 1 {
+		t.Fatalf("Wait() = %d results, want it to wait for the held submission", len(results))
+	}
+	// the extra release didn't affect the next batch
+	p.Reset()
+	release := p.Hold()
+	time.AfterFunc(20*time.Millisecond, release)
+	start := time.Now()
+	p.Wait()
+	if time.Since(start) < 10*time.Millisecond {
+		t.Error("Wait() returned while the pool was held")
+	}
+}
+
+func TestWaitWithContext(t *testing.T) {
+	p := NewSimple(2)
+	release := make(chan struct{})
+	var finished atomic.Bool
+	p.Run(func() error { <-release; finished.Store(true); return nil })
+	p.Run(func() error { return nil })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	results, err := p.WaitWithContext(ctx)
+	if err != context.DeadlineExceeded || len(results) != 1 {
+		t.Fatalf("WaitWithContext() = %d results, %v, want 1 and context.DeadlineExceeded", len(results), err)
+	}
+
+	// giving up on waiting leaves the running task alone
+	close(release)
+	rest := p.Wait()
+	if len(rest) != 1 || !rest[0].Success || !finished.Load() {
+		t.Errorf("Wait() = %+v, want the held task to finish normally", rest)
+	}
+}
+
+func TestTotals(t *testing.T) {
+	errFailed := errors.New("failed")
+	p := NewSimple(3)
+	for batch := 1; batch <= 2; batch++ {
+		for i := 0; i < 10; i++ {
+			p.Run(func() error {
+				if i%5 == 0 {
+					return errFailed
+				}
+				return nil
+			})
+		}
+		p.Wait()
+		p.Reset()
+
+		if s := p.Stats(); s.Submitted != 0 || s.Completed != 0 {
+			t.Fatalf("batch %d: Stats() after Reset = %+v, want zero counters", batch, s)
+		}
+		want := uint64(batch)
+		if got := [3]uint64{p.TotalSubmitted(), p.TotalCompleted(), p.TotalFailed()}; got != [3]uint64{10 * want, 8 * want, 2 * want} {
+			t.Errorf("batch %d: totals (submitted, completed, failed) = %v, want %v", batch, got, [3]uint64{10 * want, 8 * want, 2 * want})
+		}
+	}
+}
+
+func TestRunIf(t *testing.T) {
+	tests := []struct {
+		name   string
+		submit func(p *Pool, task func() error) uint64
+		runs   bool
+	}{
+		{"RunIf true", func(p *Pool, task func() error) uint64 { return p.RunIf(true, task) }, true},
+		{"RunIf false", func(p *Pool, task func() error) uint64 { return p.RunIf(false, task) }, false},
+		{"RunUnless false", func(p *Pool, task func() error) uint64 { return p.RunUnless(false, task) }, true},
+		{"RunUnless true", func(p *Pool, task func() error) uint64 { return p.RunUnless(true, task) }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewSimple(2)
+			before := p.Run(func() error { return nil })
+			var ran bool
+			id := tt.submit(p, func() error { ran = true; return nil })
+			after := p.Run(func() error { return nil })
+			results := p.Wait()
+
+			wantResults, wantID, wantAfter := 2, uint64(0), before+1
+			if tt.runs {
+				wantResults, wantID, wantAfter = 3, before+1, before+2
+			}
+			if ran != tt.runs || len(results) != wantResults {
+				t.Errorf("task ran = %v with %d results, want %v and %d", ran, len(results), tt.runs, wantResults)
+			}
+			if id != wantID || after != wantAfter {
+				t.Errorf("got IDs %d and then %d, want %d and %d", id, after, wantID, wantAfter)
+			}
+			if s := p.Stats(); s.Submitted != uint64(wantResults) {
+				t.Errorf("Stats().Submitted = %d, want %d", s.Submitted, wantResults)
+			}
+		})
+	}
+}
+
+func TestWaitError(t *testing.T) {
+	errA, errB := errors.New("a"), errors.New("b")
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name  string
+		opts  []Option
+		tasks []func() error
+		// a task bound to a cancelled context is added when set
+		withCancelled bool
+		want          []error
+	}{
+		{"none fail", nil, []func() error{func() error { return nil }}, false, nil},
+		{"one fails", nil, []func() error{func() error { return nil }, func() error { return errA }}, false, []error{errA}},
+		{"several fail", nil, []func() error{func() error { return errA }, func() error { return errB }}, false, []error{errA, errB}},
+		{"cancelled ignored", nil, []func() error{func() error { return errA }}, true, []error{errA}},
+		{"cancelled as error", []Option{WithCancelledAsError()}, []func() error{func() error { return errA }}, true, []error{errA, context.Canceled}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			submit := func() *Pool {
+				// one at a time, so errors come in submission order
+				p := New(append(tt.opts, WithMaxConcurrency(1))...)
+				for _, task := range tt.tasks {
+					p.Run(task)
+				}
+				if tt.withCancelled {
+					p.RunWithContext(cancelled, func() error { return nil })
+				}
+				return p
+			}
+
+			errs := submit().WaitErrors()
+			if len(errs) != len(tt.want) {
+				t.Fatalf("WaitErrors() = %v, want %v", errs, tt.want)
+			}
+			for i, want := range tt.want {
+				if !errors.Is(errs[i], want) {
+					t.Errorf("WaitErrors()[%d] = %v, want %v", i, errs[i], want)
+				}
+			}
+
+			err := submit().WaitError()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("WaitError() = %v, want nil", err)
+				}
+			} else if !errors.Is(err, tt.want[0]) {
+				t.Errorf("WaitError() = %v, want %v", err, tt.want[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package concpool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ProgressSnapshot is a point-in-time view of a pool's progress, as sent by
+// ProgressChan.
+type ProgressSnapshot struct {
+	// Completed and Total are as returned by Progress.
+	Completed int
+	Total     int
+	// Running and Pending are as returned by Running and Pending.
+	Running int
+	Pending int
+	// ElapsedTime is the time since ProgressChan was called.
+	ElapsedTime time.Duration
+}
+
+// Progress returns how many tasks have produced a TaskResult so far and
+// how many have been submitted, since the pool was created or last Reset.
+// Completed counts every result, whether the task succeeded, failed or was
+// cancelled, so completed == total once the pool has nothing left to do.
+func (p *Pool) Progress() (completed, total int) {
+	done := p.counts.completed.Load() + p.counts.failed.Load() + p.counts.cancelled.Load()
+	return int(done), int(p.counts.submitted.Load())
+}
+
+// ProgressChan returns a channel on which a ProgressSnapshot is sent every
+// interval. A snapshot is skipped if the receiver isn't ready for it. Once
+// the pool terminates, a final snapshot replaces any unread one and the
+// channel is closed, so it can be consumed with a range loop, or abandoned
+// without leaking the goroutine that feeds it; the pool must be waited on
+// for that to happen.
+func (p *Pool) ProgressChan(interval time.Duration) <-chan ProgressSnapshot {
+	p.lazyInit()
+	ch := make(chan ProgressSnapshot, 1)
+	start := time.Now()
+
+	snapshot := func() (ProgressSnapshot, bool) {
+		completed, total := p.Progress()
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return ProgressSnapshot{
+			Completed:   completed,
+			Total:       total,
+			Running:     p.running,
+			Pending:     p.queue.len(),
+			ElapsedTime: time.Since(start),
+		}, p.terminated
+	}
+
+	p.spawn(func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s, terminated := snapshot()
+			if terminated {
+				// replace any snapshot the receiver hasn't taken, so
+				// the final send can't block on a receiver that has
+				// stopped reading
+				select {
+				case <-ch:
+				default:
+				}
+				ch <- s
+				return
+			}
+			select {
+			case ch <- s:
+			default:
+			}
+		}
+	})
+	return ch
+}
+
+// WaitProgress is like Wait but also calls fn every interval with the
+// number of results collected so far and the number of tasks submitted,
+// for progress bars and log lines without a separate ProgressChan
+// consumer. fn is called from a goroutine of its own, one call at a time,
+// and not at all once WaitProgress has returned.
+func (p *Pool) WaitProgress(interval time.Duration, fn func(completed, total int)) []TaskResult {
+	p.lazyInit()
+	var collected atomic.Int64
+	stop := make(chan struct{})
+	var ticking sync.WaitGroup
+	ticking.Add(1)
+	p.spawn(func() {
+		defer ticking.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				fn(int(collected.Load()), int(p.counts.submitted.Load()))
+			case <-stop:
+				return
+			}
+		}
+	})
+	defer func() {
+		close(stop)
+		ticking.Wait()
+	}()
+
+	p.mu.Lock()
+	streaming := p.stream != nil
+	p.mu.Unlock()
+	if streaming {
+		return nil
+	}
+
+	results := make([]TaskResult, 0)
+	p.loop(context.Background(), func(r TaskResult) {
+		results = append(results, r)
+		collected.Add(1)
+	})
+	return results
+}
+
+// WaitGroup returns a sync.WaitGroup whose counter is the number of tasks
+// that are queued or running right now, and that is decremented as each of
+// them produces its result. It lets code built around sync.WaitGroup wait
+// for the pool's current work with wg.Wait, at the cost of the
+// TaskResults. Tasks submitted later are not counted.
+//
+// The WaitGroup does not make the pool run its tasks: as with Submit, the
+// pool must be waited on (or Results consumed) in some goroutine for it to
+// reach zero.
+func (p *Pool) WaitGroup() *sync.WaitGroup {
+	p.lazyInit()
+	wg := new(sync.WaitGroup)
+
+	p.mu.Lock()
+	p.queue.each(func(t *job) { t.addWaitGroup(wg) })
+	for _, t := range p.inflight {
+		t.addWaitGroup(wg)
+	}
+	p.mu.Unlock()
+	return wg
+}
@@ -0,0 +1,125 @@
+package concpool
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	p := NewSimple(2)
+	if c, n := p.Progress(); c != 0 || n != 0 {
+		t.Fatalf("Progress() = %d, %d on a new pool", c, n)
+	}
+	for i := 0; i < 20; i++ {
+		p.Run(func() error { time.Sleep(time.Millisecond); return nil })
+	}
+	if c, n := p.Progress(); c != 0 || n != 20 {
+		t.Fatalf("Progress() = %d, %d before Wait, want 0, 20", c, n)
+	}
+
+	snapshots := p.ProgressChan(2 * time.Millisecond)
+	p.Wait()
+	if c, n := p.Progress(); c != n || n != 20 {
+		t.Fatalf("Progress() = %d, %d after Wait, want 20, 20", c, n)
+	}
+
+	var last ProgressSnapshot
+	timeout := time.After(5 * time.Second)
+	for closed := false; !closed; {
+		select {
+		case s, ok := <-snapshots:
+			if !ok {
+				closed = true
+				break
+			}
+			if s.Completed > s.Total || s.Total != 20 {
+				t.Fatalf("inconsistent snapshot %+v", s)
+			}
+			last = s
+		case <-timeout:
+			t.Fatal("ProgressChan was not closed after the pool terminated")
+		}
+	}
+	if last.Completed != 20 || last.Running != 0 || last.Pending != 0 || last.ElapsedTime <= 0 {
+		t.Fatalf("final snapshot = %+v, want everything completed", last)
+	}
+}
+
+func TestProgressChanAbandoned(t *testing.T) {
+	p := NewSimple(1)
+	p.Run(func() error { time.Sleep(20 * time.Millisecond); return nil })
+	// never read from, so the buffer is full when the pool terminates
+	snapshots := p.ProgressChan(time.Millisecond)
+	p.Wait()
+	if n := waitGoroutines(p, 0); n != 0 {
+		t.Fatalf("%d goroutines left after Wait, want the ProgressChan one to exit without a reader", n)
+	}
+
+	s, ok := <-snapshots
+	if !ok || s.Completed != 1 || s.Total != 1 {
+		t.Fatalf("first receive = %+v, %v, want the final snapshot", s, ok)
+	}
+	if _, ok := <-snapshots; ok {
+		t.Fatal("ProgressChan was not closed after the final snapshot")
+	}
+}
+
+func TestWaitGroup(t *testing.T) {
+	p := NewSimple(3)
+	var finished atomic.Int32
+	release := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		p.Run(func() error { <-release; finished.Add(1); return nil })
+	}
+	wg := p.WaitGroup()
+
+	waited := make(chan int32)
+	go func() { wg.Wait(); waited <- finished.Load() }()
+	pooled := make(chan int)
+	go func() { pooled <- len(p.Wait()) }()
+
+	select {
+	case <-waited:
+		t.Fatal("wg.Wait() returned while tasks were still pending")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if n := <-waited; n != 10 {
+		t.Fatalf("wg.Wait() returned after %d of 10 tasks finished", n)
+	}
+	if n := <-pooled; n != 10 {
+		t.Fatalf("Wait() returned %d results, want 10", n)
+	}
+}
+
+func TestWaitProgress(t *testing.T) {
+	p := NewSimple(2)
+	for i := 0; i < 10; i++ {
+		p.Run(func() error { time.Sleep(10 * time.Millisecond); return nil })
+	}
+	var calls, early atomic.Int32
+	var last atomic.Int32
+	results := p.WaitProgress(5*time.Millisecond, func(completed, total int) {
+		calls.Add(1)
+		if completed < total {
+			early.Add(1)
+		}
+		if completed < int(last.Load()) || total != 10 {
+			t.Errorf("fn(%d, %d) after %d completed, want a growing count out of 10", completed, total, last.Load())
+		}
+		last.Store(int32(completed))
+	})
+	afterWait := calls.Load()
+
+	if len(results) != 10 {
+		t.Fatalf("WaitProgress() = %d results, want 10", len(results))
+	}
+	if early.Load() == 0 {
+		t.Error("fn was not called before the tasks completed")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := calls.Load(); n != afterWait {
+		t.Errorf("fn was called %d more times after WaitProgress returned", n-afterWait)
+	}
+}
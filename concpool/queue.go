@@ -0,0 +1,454 @@
+package concpool
+
+import (
+	"cmp"
+	"container/heap"
+)
+
+// jobQueue holds the tasks waiting to start. The pool accesses it under
+// p.mu only, so implementations need no locking of their own.
+type jobQueue interface {
+	push(t *job)
+	// pop removes and returns the next job to start, or nil if the queue
+	// is empty.
+	pop() *job
+	// peek returns the job pop would return without removing it, or nil.
+	peek() *job
+	len() int
+	// clear empties the queue and returns the jobs it held.
+	clear() []*job
+	// each calls fn for every queued job, in no particular order.
+	each(fn func(*job))
+}
+
+// ringBuffer is the default FIFO queue, and the storage behind SliceQueue
+// and RingQueue. Items live in a circular buffer, so popping never
+// re-slices and a queue that stays within its capacity never allocates;
+// when full, push doubles the buffer. With lifo set it pops the most
+// recently pushed item first.
+type ringBuffer[T any] struct {
+	buf  []T
+	head int
+	n    int
+	lifo bool
+}
+
+func newRingBuffer[T any](capacity int, lifo bool) *ringBuffer[T] {
+	return &ringBuffer[T]{buf: make([]T, capacity), lifo: lifo}
+}
+
+func (q *ringBuffer[T]) push(v T) {
+	if q.n == len(q.buf) {
+		q.grow()
+	}
+	q.buf[(q.head+q.n)%len(q.buf)] = v
+	q.n++
+}
+
+// grow doubles the buffer, moving the items to its start in order.
+func (q *ringBuffer[T]) grow() {
+	buf := make([]T, max(2*len(q.buf), 8))
+	q.copyTo(buf)
+	q.buf, q.head = buf, 0
+}
+
+// copyTo copies the items, oldest first, to the start of dst.
+func (q *ringBuffer[T]) copyTo(dst []T) {
+	n := copy(dst, q.buf[q.head:min(q.head+q.n, len(q.buf))])
+	copy(dst[n:], q.buf[:q.n-n])
+}
+
+// pop removes and returns the next item, or the zero value if the queue is
+// empty.
+func (q *ringBuffer[T]) pop() T {
+	var zero T
+	if q.n == 0 {
+		return zero
+	}
+	i := q.next()
+	v := q.buf[i]
+	q.buf[i] = zero
+	if !q.lifo {
+		q.head = (q.head + 1) % len(q.buf)
+	}
+	q.n--
+	return v
+}
+
+// peek returns the item pop would return without removing it.
+func (q *ringBuffer[T]) peek() T {
+	if q.n == 0 {
+		var zero T
+		return zero
+	}
+	return q.buf[q.next()]
+}
+
+// next returns the index of the item pop would return. The queue must not
+// be empty.
+func (q *ringBuffer[T]) next() int {
+	if q.lifo {
+		return (q.head + q.n - 1) % len(q.buf)
+	}
+	return q.head
+}
+
+func (q *ringBuffer[T]) len() int {
+	return q.n
+}
+
+// cap returns how many items fit without growing the buffer.
+func (q *ringBuffer[T]) cap() int {
+	return len(q.buf)
+}
+
+// clear empties the queue, keeping its buffer, and returns the items in
+// the order they were pushed.
+func (q *ringBuffer[T]) clear() []T {
+	items := make([]T, q.n)
+	q.copyTo(items)
+	clear(q.buf)
+	q.head, q.n = 0, 0
+	return items
+}
+
+func (q *ringBuffer[T]) each(fn func(T)) {
+	for i := 0; i < q.n; i++ {
+		fn(q.buf[(q.head+i)%len(q.buf)])
+	}
+}
+
+// priorityQueue starts jobs with a higher priority first, or in the order
+// set by its heap's order function. Jobs that rank equal start in
+// submission order.
+type priorityQueue struct {
+	jobs jobHeap
+}
+
+func (q *priorityQueue) push(t *job) {
+	heap.Push(&q.jobs, t)
+}
+
+func (q *priorityQueue) pop() *job {
+	if len(q.jobs.items) == 0 {
+		return nil
+	}
+	return heap.Pop(&q.jobs).(*job)
+}
+
+func (q *priorityQueue) peek() *job {
+	if len(q.jobs.items) == 0 {
+		return nil
+	}
+	return q.jobs.items[0]
+}
+
+func (q *priorityQueue) len() int {
+	return len(q.jobs.items)
+}
+
+func (q *priorityQueue) clear() []*job {
+	jobs := make([]*job, 0, len(q.jobs.items))
+	for len(q.jobs.items) > 0 {
+		jobs = append(jobs, heap.Pop(&q.jobs).(*job))
+	}
+	return jobs
+}
+
+func (q *priorityQueue) each(fn func(*job)) {
+	for _, t := range q.jobs.items {
+		fn(t)
+	}
+}
+
+// higherPriority orders jobs by priority, highest first.
+func higherPriority(a, b *job) int {
+	return cmp.Compare(b.priority, a.priority)
+}
+
+// lighter orders jobs by weight, lightest first.
+func lighter(a, b *job) int {
+	return cmp.Compare(a.cost(), b.cost())
+}
+
+// jobHeap implements heap.Interface ordered by order, then ID. A nil order
+// means higherPriority.
+type jobHeap struct {
+	items []*job
+	order func(a, b *job) int
+}
+
+func (h *jobHeap) Len() int { return len(h.items) }
+
+func (h *jobHeap) Less(i, j int) bool {
+	order := h.order
+	if order == nil {
+		order = higherPriority
+	}
+	if c := order(h.items[i], h.items[j]); c != 0 {
+		return c < 0
+	}
+	return h.items[i].id < h.items[j].id
+}
+
+func (h *jobHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *jobHeap) Push(x any) { h.items = append(h.items, x.(*job)) }
+
+func (h *jobHeap) Pop() any {
+	n := len(h.items)
+	t := h.items[n-1]
+	h.items[n-1] = nil
+	h.items = h.items[:n-1]
+	return t
+}
+
+// Queue is the interface for plugging a custom queue into a pool with
+// WithQueue. It holds the tasks waiting to start, and Pop decides which one
+// starts next. The pool only calls it while holding its own lock, so
+// implementations need no locking, but a Queue must not be shared between
+// pools or used by anything else while a pool owns it.
+//
+// The tasks the pool pushes are wrappers around the submitted functions;
+// Pop and Peek must return them unchanged.
+type Queue interface {
+	Push(task func() error)
+	// Pop removes and returns the next task to start, or false if the
+	// queue is empty.
+	Pop() (func() error, bool)
+	// Peek returns the task Pop would return, without removing it.
+	Peek() (func() error, bool)
+	Len() int
+}
+
+// SliceQueue is a Queue that starts tasks in FIFO order, like a pool does
+// by default. The zero value is ready to use.
+type SliceQueue struct {
+	q ringBuffer[func() error]
+}
+
+// NewSliceQueue returns an empty SliceQueue.
+func NewSliceQueue() *SliceQueue {
+	return &SliceQueue{}
+}
+
+func (q *SliceQueue) Push(task func() error) {
+	q.q.push(task)
+}
+
+func (q *SliceQueue) Pop() (func() error, bool) {
+	if q.q.len() == 0 {
+		return nil, false
+	}
+	return q.q.pop(), true
+}
+
+func (q *SliceQueue) Peek() (func() error, bool) {
+	if q.q.len() == 0 {
+		return nil, false
+	}
+	return q.q.peek(), true
+}
+
+func (q *SliceQueue) Len() int {
+	return q.q.len()
+}
+
+// HeapQueue is a Queue that starts tasks with a higher priority first, and
+// tasks with equal priority in the order they were pushed. Push uses
+// priority 0; a pool using a HeapQueue pushes tasks with the priority given
+// to Pool.RunWithPriority. The zero value is ready to use.
+type HeapQueue struct {
+	tasks taskHeap
+	seq   uint64
+}
+
+// NewHeapQueue returns an empty HeapQueue.
+func NewHeapQueue() *HeapQueue {
+	return &HeapQueue{}
+}
+
+func (q *HeapQueue) Push(task func() error) {
+	q.PushPriority(task, 0)
+}
+
+// PushPriority adds task with the given priority.
+func (q *HeapQueue) PushPriority(task func() error, priority int) {
+	q.seq++
+	heap.Push(&q.tasks, prioritizedTask{task: task, priority: priority, seq: q.seq})
+}
+
+func (q *HeapQueue) Pop() (func() error, bool) {
+	if len(q.tasks) == 0 {
+		return nil, false
+	}
+	return heap.Pop(&q.tasks).(prioritizedTask).task, true
+}
+
+func (q *HeapQueue) Peek() (func() error, bool) {
+	if len(q.tasks) == 0 {
+		return nil, false
+	}
+	return q.tasks[0].task, true
+}
+
+func (q *HeapQueue) Len() int {
+	return len(q.tasks)
+}
+
+type prioritizedTask struct {
+	task     func() error
+	priority int
+	seq      uint64
+}
+
+// taskHeap implements heap.Interface ordered by priority, then push order.
+type taskHeap []prioritizedTask
+
+func (h taskHeap) Len() int { return len(h) }
+
+func (h taskHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h taskHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *taskHeap) Push(x any) { *h = append(*h, x.(prioritizedTask)) }
+
+func (h *taskHeap) Pop() any {
+	old := *h
+	n := len(old)
+	t := old[n-1]
+	old[n-1] = prioritizedTask{}
+	*h = old[:n-1]
+	return t
+}
+
+// RingQueue is a fixed-capacity FIFO Queue backed by a ring buffer, so it
+// never allocates after creation. Push panics if the queue is full; a pool
+// using a RingQueue limits its queue to the ring's capacity, reporting
+// tasks beyond it with ErrQueueFull as WithMaxQueue does.
+type RingQueue struct {
+	q ringBuffer[func() error]
+}
+
+// NewRingQueue returns an empty RingQueue that holds up to capacity tasks
+// (at least 1).
+func NewRingQueue(capacity int) *RingQueue {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &RingQueue{q: ringBuffer[func() error]{buf: make([]func() error, capacity)}}
+}
+
+func (q *RingQueue) Push(task func() error) {
+	if q.q.len() == q.q.cap() {
+		panic("concpool: RingQueue is full")
+	}
+	q.q.push(task)
+}
+
+func (q *RingQueue) Pop() (func() error, bool) {
+	if q.q.len() == 0 {
+		return nil, false
+	}
+	return q.q.pop(), true
+}
+
+func (q *RingQueue) Peek() (func() error, bool) {
+	if q.q.len() == 0 {
+		return nil, false
+	}
+	return q.q.peek(), true
+}
+
+func (q *RingQueue) Len() int {
+	return q.q.len()
+}
+
+// Cap returns the number of tasks the queue can hold.
+func (q *RingQueue) Cap() int {
+	return q.q.cap()
+}
+
+// externalQueue adapts a Queue set with WithQueue to jobQueue. It pushes a
+// closure per job and, to map a popped closure back to its job, calls it
+// with resolving set, which makes it report its job instead of running.
+type externalQueue struct {
+	q Queue
+	// jobs are the queued jobs by ID.
+	jobs      map[uint64]*job
+	resolving bool
+	resolved  *job
+}
+
+func newExternalQueue(q Queue) *externalQueue {
+	return &externalQueue{q: q, jobs: make(map[uint64]*job)}
+}
+
+func (e *externalQueue) push(t *job) {
+	e.jobs[t.id] = t
+	task := func() error {
+		if e.resolving {
+			e.resolved = t
+			return nil
+		}
+		return t.fn()
+	}
+	if pq, ok := e.q.(interface{ PushPriority(func() error, int) }); ok {
+		pq.PushPriority(task, t.priority)
+		return
+	}
+	e.q.Push(task)
+}
+
+func (e *externalQueue) pop() *job {
+	task, ok := e.q.Pop()
+	if !ok {
+		return nil
+	}
+	t := e.resolve(task)
+	delete(e.jobs, t.id)
+	return t
+}
+
+func (e *externalQueue) peek() *job {
+	task, ok := e.q.Peek()
+	if !ok {
+		return nil
+	}
+	return e.resolve(task)
+}
+
+// resolve returns the job behind a task returned by the Queue.
+func (e *externalQueue) resolve(task func() error) *job {
+	e.resolving = true
+	task()
+	t := e.resolved
+	e.resolving, e.resolved = false, nil
+	if t == nil {
+		panic("concpool: Queue returned a task the pool did not push")
+	}
+	return t
+}
+
+func (e *externalQueue) len() int {
+	return e.q.Len()
+}
+
+func (e *externalQueue) clear() []*job {
+	jobs := make([]*job, 0, e.q.Len())
+	for t := e.pop(); t != nil; t = e.pop() {
+		jobs = append(jobs, t)
+	}
+	return jobs
+}
+
+func (e *externalQueue) each(fn func(*job)) {
+	for _, t := range e.jobs {
+		fn(t)
+	}
+}
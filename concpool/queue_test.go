@@ -0,0 +1,443 @@
+package concpool
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunWithPriority(t *testing.T) {
+	p := New(WithMaxConcurrency(1), WithPriorityQueue())
+	var mu sync.Mutex
+	var order []string
+	submit := func(priority int, name string) {
+		p.RunWithPriority(priority, func() error {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			return nil
+		})
+	}
+	submit(0, "low-1")
+	submit(5, "high-1")
+	submit(0, "low-2")
+	submit(10, "urgent")
+	submit(5, "high-2")
+	p.Run(func() error {
+		mu.Lock()
+		order = append(order, "low-3")
+		mu.Unlock()
+		return nil
+	})
+	p.Wait()
+
+	want := []string{"urgent", "high-1", "high-2", "low-1", "low-2", "low-3"}
+	if len(order) != len(want) {
+		t.Fatalf("ran %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("ran %v, want %v", order, want)
+		}
+	}
+}
+
+func BenchmarkQueueInsert(b *testing.B) {
+	const n = 100000
+	jobs := make([]*job, n)
+	for i := range jobs {
+		jobs[i] = &job{id: uint64(i + 1), priority: i % 16}
+	}
+	queues := []struct {
+		name string
+		new  func() jobQueue
+	}{
+		{"heap", func() jobQueue { return &priorityQueue{} }},
+		{"fifo", func() jobQueue { return newRingBuffer[*job](0, false) }},
+	}
+	for _, q := range queues {
+		b.Run(q.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				queue := q.new()
+				for _, t := range jobs {
+					queue.push(t)
+				}
+			}
+		})
+	}
+}
+
+func TestQueueOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want []int
+	}{
+		{"FIFO", nil, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{"LIFO", []Option{WithLIFO()}, []int{10, 9, 8, 7, 6, 5, 4, 3, 2, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(append([]Option{WithMaxConcurrency(1)}, tt.opts...)...)
+			var mu sync.Mutex
+			var order []int
+			for i := 1; i <= 10; i++ {
+				p.Run(func() error {
+					mu.Lock()
+					order = append(order, i)
+					mu.Unlock()
+					return nil
+				})
+			}
+			p.Wait()
+			if !slices.Equal(order, tt.want) {
+				t.Fatalf("tasks completed in order %v, want %v", order, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithQueue(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name      string
+		queue     Queue
+		wantOrder []int
+		wantFull  int
+	}{
+		{"slice", NewSliceQueue(), []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, 0},
+		{"heap", NewHeapQueue(), []int{1, 3, 5, 7, 9, 0, 2, 4, 6, 8}, 0},
+		{"ring", NewRingQueue(16), []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, 0},
+		{"full ring", NewRingQueue(8), []int{0, 1, 2, 3, 4, 5, 6, 7}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// one task at a time, so they run in the order the queue pops them
+			p := New(WithMaxConcurrency(1), WithQueue(tt.queue))
+			var mu sync.Mutex
+			var order []int
+			for i := 0; i < 10; i++ {
+				p.RunWithPriority(i%2, func() error {
+					mu.Lock()
+					order = append(order, i)
+					mu.Unlock()
+					if i == 3 {
+						return errFailed
+					}
+					return nil
+				})
+			}
+			results := p.Wait()
+
+			if len(results) != 10 {
+				t.Fatalf("Wait() = %d results, want 10", len(results))
+			}
+			if !slices.Equal(order, tt.wantOrder) {
+				t.Errorf("tasks ran in order %v, want %v", order, tt.wantOrder)
+			}
+			var failed, full int
+			for _, r := range results {
+				switch {
+				case errors.Is(r.Err, ErrQueueFull):
+					full++
+				case errors.Is(r.Err, errFailed):
+					failed++
+				case !r.Success:
+					t.Errorf("task %d: unexpected error %v", r.ID, r.Err)
+				}
+			}
+			if failed != 1 || full != tt.wantFull {
+				t.Errorf("got %d failed and %d rejected tasks, want 1 and %d", failed, full, tt.wantFull)
+			}
+			if n := tt.queue.Len(); n != 0 {
+				t.Errorf("queue still holds %d tasks", n)
+			}
+		})
+	}
+}
+
+func TestQueueImplementations(t *testing.T) {
+	queues := map[string]Queue{"slice": NewSliceQueue(), "heap": NewHeapQueue(), "ring": NewRingQueue(4)}
+	for name, q := range queues {
+		t.Run(name, func(t *testing.T) {
+			if _, ok := q.Pop(); ok {
+				t.Fatal("Pop() on an empty queue returned a task")
+			}
+			if _, ok := q.Peek(); ok {
+				t.Fatal("Peek() on an empty queue returned a task")
+			}
+			var got []int
+			for i := 0; i < 4; i++ {
+				q.Push(func() error { got = append(got, i); return nil })
+			}
+			if q.Len() != 4 {
+				t.Fatalf("Len() = %d, want 4", q.Len())
+			}
+			for q.Len() > 0 {
+				peeked, _ := q.Peek()
+				popped, ok := q.Pop()
+				if !ok {
+					t.Fatal("Pop() failed on a non-empty queue")
+				}
+				peeked()
+				popped()
+			}
+			// Peek and Pop returned the same task, so each ran twice
+			if want := []int{0, 0, 1, 1, 2, 2, 3, 3}; !slices.Equal(got, want) {
+				t.Errorf("tasks popped in order %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSetQueue(t *testing.T) {
+	p := New(WithMaxConcurrency(1), WithQueue(NewSliceQueue()))
+	for i := 0; i < 100; i++ {
+		p.Run(func() error { return nil })
+	}
+	if err := p.SetQueue(NewHeapQueue()); err != nil {
+		t.Fatalf("SetQueue() error = %v", err)
+	}
+	urgent := p.RunWithPriority(10, func() error { return nil })
+	results := p.Wait()
+
+	if len(results) != 101 || HasErrors(results) {
+		t.Fatalf("Wait() = %d results, want 101 successes", len(results))
+	}
+	if results[0].ID != urgent {
+		t.Errorf("task %d started first, want the urgent task %d", results[0].ID, urgent)
+	}
+	// the swapped tasks kept their FIFO order
+	for i, r := range results[1:] {
+		if r.ID != uint64(i+1) {
+			t.Fatalf("result %d is task %d, want %d", i+1, r.ID, i+1)
+		}
+	}
+}
+
+func TestSetQueueErrors(t *testing.T) {
+	nonEmpty := NewSliceQueue()
+	nonEmpty.Push(func() error { return nil })
+	tests := []struct {
+		name  string
+		queue Queue
+	}{
+		{"non-empty queue", nonEmpty},
+		{"too small", NewRingQueue(5)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewSimple(1)
+			p.RunN(10, func() error { return nil })
+			if err := p.SetQueue(tt.queue); err == nil {
+				t.Error("SetQueue() succeeded, want an error")
+			}
+			if results := p.Wait(); len(results) != 10 {
+				t.Errorf("Wait() = %d results, want the queue left intact", len(results))
+			}
+		})
+	}
+
+	t.Run("running", func(t *testing.T) {
+		p := NewSimple(1)
+		release := make(chan struct{})
+		p.Run(func() error { <-release; return nil })
+		done := make(chan []TaskResult)
+		go func() { done <- p.Wait() }()
+		for p.Running() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		if err := p.SetQueue(NewHeapQueue()); err == nil {
+			t.Error("SetQueue() succeeded while a task was running, want an error")
+		}
+		close(release)
+		<-done
+	})
+}
+
+func TestRingBuffer(t *testing.T) {
+	for _, lifo := range []bool{false, true} {
+		t.Run(fmt.Sprintf("lifo=%v", lifo), func(t *testing.T) {
+			// start small, so the buffer wraps around and grows
+			q := newRingBuffer[int](2, lifo)
+			var want []int
+			for i := 0; i < 1000; i++ {
+				if i%3 != 2 {
+					q.push(i)
+					want = append(want, i)
+					continue
+				}
+				var next int
+				if lifo {
+					next, want = want[len(want)-1], want[:len(want)-1]
+				} else {
+					next, want = want[0], want[1:]
+				}
+				if got := q.peek(); got != next {
+					t.Fatalf("peek() = %d, want %d", got, next)
+				}
+				if got := q.pop(); got != next {
+					t.Fatalf("pop() = %d, want %d", got, next)
+				}
+			}
+			var each []int
+			q.each(func(v int) { each = append(each, v) })
+			if !slices.Equal(each, want) {
+				t.Errorf("each() visited %d items, want the %d queued in push order", len(each), len(want))
+			}
+			if got := q.clear(); !slices.Equal(got, want) || q.len() != 0 {
+				t.Errorf("clear() = %d items leaving %d, want %d leaving 0", len(got), q.len(), len(want))
+			}
+			if q.pop() != 0 || q.peek() != 0 {
+				t.Error("empty queue returned an item")
+			}
+		})
+	}
+}
+
+func TestQueueCapacity(t *testing.T) {
+	tests := []struct {
+		name     string
+		overflow []Option
+		wantFull int
+	}{
+		{"grow", nil, 0},
+		{"explicit grow", []Option{WithOverflowGrow()}, 0},
+		{"drop", []Option{WithOverflowDrop()}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(append(tt.overflow, WithMaxConcurrency(2), WithQueueCapacity(4))...)
+			p.RunN(6, func() error { return nil })
+			results := p.Wait()
+			full := 0
+			for _, r := range results {
+				if errors.Is(r.Err, ErrQueueFull) {
+					full++
+				}
+			}
+			if len(results) != 6 || full != tt.wantFull {
+				t.Errorf("Wait() = %d results with %d rejected, want 6 with %d", len(results), full, tt.wantFull)
+			}
+		})
+	}
+}
+
+func TestOverflowBlock(t *testing.T) {
+	p := New(WithMaxConcurrency(2), WithQueueCapacity(4), WithOverflowBlock())
+	release := p.Hold()
+	done := make(chan []TaskResult)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		done <- p.Wait()
+	}()
+	start := time.Now()
+	var ran atomic.Int32
+	for i := 0; i < 50; i++ {
+		p.Run(func() error { ran.Add(1); return nil })
+	}
+	if d := time.Since(start); d < 15*time.Millisecond {
+		t.Errorf("submitting past the capacity took %v, want it to wait for Wait", d)
+	}
+	release()
+	if results := <-done; len(results) != 50 || ran.Load() != 50 {
+		t.Fatalf("Wait() = %d results from %d runs, want 50", len(results), ran.Load())
+	}
+}
+
+// sliceQueue is the queue pools used before the ring buffer: append to
+// push, re-slice from the front to pop.
+type sliceQueue []*job
+
+func (q *sliceQueue) push(t *job) { *q = append(*q, t) }
+
+func (q *sliceQueue) pop() *job {
+	if len(*q) == 0 {
+		return nil
+	}
+	t := (*q)[0]
+	(*q)[0] = nil
+	*q = (*q)[1:]
+	return t
+}
+
+func (q *sliceQueue) peek() *job {
+	if len(*q) == 0 {
+		return nil
+	}
+	return (*q)[0]
+}
+
+func (q *sliceQueue) len() int { return len(*q) }
+
+func (q *sliceQueue) clear() []*job {
+	jobs := *q
+	*q = nil
+	return jobs
+}
+
+func (q *sliceQueue) each(fn func(*job)) {
+	for _, t := range *q {
+		fn(t)
+	}
+}
+
+// BenchmarkQueueGC moves a million jobs through the ring buffer and the
+// old slice queue, queueing them all up front ("fill") and through a queue
+// kept 1024 deep ("steady"), and reports the garbage collections each run
+// causes.
+func BenchmarkQueueGC(b *testing.B) {
+	const total, depth = 1_000_000, 1024
+	jobs := make([]*job, total)
+	for i := range jobs {
+		jobs[i] = &job{id: uint64(i + 1)}
+	}
+	queues := []struct {
+		name string
+		new  func() jobQueue
+	}{
+		{"ring", func() jobQueue { return newRingBuffer[*job](depth, false) }},
+		{"slice", func() jobQueue { return &sliceQueue{} }},
+	}
+	patterns := []struct {
+		name string
+		run  func(q jobQueue)
+	}{
+		{"fill", func(q jobQueue) {
+			for _, t := range jobs {
+				q.push(t)
+			}
+			for q.len() > 0 {
+				q.pop()
+			}
+		}},
+		{"steady", func(q jobQueue) {
+			for _, t := range jobs[:depth] {
+				q.push(t)
+			}
+			for _, t := range jobs[depth:] {
+				q.pop()
+				q.push(t)
+			}
+		}},
+	}
+	for _, pattern := range patterns {
+		for _, queue := range queues {
+			b.Run(pattern.name+"/"+queue.name, func(b *testing.B) {
+				b.ReportAllocs()
+				var before, after runtime.MemStats
+				runtime.ReadMemStats(&before)
+				for i := 0; i < b.N; i++ {
+					pattern.run(queue.new())
+				}
+				runtime.ReadMemStats(&after)
+				b.ReportMetric(float64(after.NumGC-before.NumGC)/float64(b.N), "gcs/op")
+			})
+		}
+	}
+}
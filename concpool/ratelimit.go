@@ -0,0 +1,98 @@
+package concpool
+
+import (
+	"math"
+	"time"
+)
+
+// tokenBucket limits how fast a pool starts tasks. It holds up to burst
+// tokens and gains rate tokens per second; starting a task takes one. All
+// fields are guarded by the pool's mutex.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	// waking is set while a timer is pending to retry the queue once the
+	// next token is due.
+	waking bool
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// refill adds the tokens earned since the last call.
+func (b *tokenBucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// take removes a token and reports whether one was available.
+func (b *tokenBucket) take(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// refund returns a token taken for a task that didn't start after all.
+func (b *tokenBucket) refund() {
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
+
+// delay returns how long it takes from now until a token is available.
+func (b *tokenBucket) delay(now time.Time) time.Duration {
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// NewRateLimited creates a pool that runs up to maxConcurrency tasks at
+// once and starts at most tasksPerSecond of them per second, which keeps a
+// recovering downstream from being hit by the whole queue at once. Up to
+// WithBurst tasks (default 1) may start back to back before the rate
+// applies. opts configure the pool as for New; a tasksPerSecond of zero or
+// less means no limit.
+//
+// Tasks that are queued while the pool waits for the rate limit still
+// count as pending. The tokens currently available are reported in
+// Stats.CurrentTokens.
+func NewRateLimited(maxConcurrency int, tasksPerSecond float64, opts ...Option) *Pool {
+	p := New(append([]Option{WithMaxConcurrency(maxConcurrency)}, opts...)...)
+	if tasksPerSecond > 0 {
+		p.limiter = newTokenBucket(tasksPerSecond, p.burst)
+	}
+	return p
+}
+
+// waitForToken arranges for the queue to be checked again once the rate
+// limiter has a token. The caller must hold p.mu.
+func (p *Pool) waitForToken(now time.Time) {
+	if p.limiter.waking {
+		return
+	}
+	p.limiter.waking = true
+	time.AfterFunc(p.limiter.delay(now), func() {
+		p.mu.Lock()
+		p.limiter.waking = false
+		p.mu.Unlock()
+
+		p.checkQueue()
+	})
+}
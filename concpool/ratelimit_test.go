@@ -0,0 +1,67 @@
+package concpool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimited(t *testing.T) {
+	if testing.Short() {
+		t.Skip("takes ten seconds")
+	}
+	t.Parallel()
+	p := NewRateLimited(50, 100)
+	p.RunN(1000, func() error { return nil })
+	start := time.Now()
+	results := p.Wait()
+	elapsed := time.Since(start)
+
+	if len(results) != 1000 {
+		t.Fatalf("got %d results, want 1000", len(results))
+	}
+	// the first task starts on the initial token
+	if want := 999 * 10 * time.Millisecond; elapsed < want*95/100 || elapsed > want*110/100 {
+		t.Fatalf("1000 tasks at 100/s took %v, want about %v", elapsed, want)
+	}
+}
+
+func TestRateLimitedBurst(t *testing.T) {
+	p := NewRateLimited(10, 10, WithBurst(5))
+	if s := p.Stats(); s.CurrentTokens != 5 {
+		t.Fatalf("Stats().CurrentTokens = %v, want a full burst of 5", s.CurrentTokens)
+	}
+	p.RunN(6, func() error { return nil })
+	start := time.Now()
+	p.Wait()
+	// five tasks start straight away, the sixth waits for a token
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond || elapsed > 300*time.Millisecond {
+		t.Fatalf("a burst of 5 plus one task at 10/s took %v, want about 100ms", elapsed)
+	}
+	if s := p.Stats(); s.CurrentTokens >= 1 {
+		t.Fatalf("Stats().CurrentTokens = %v right after the burst, want less than 1", s.CurrentTokens)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(10, 2)
+	b.last = now
+	for i := 0; i < 2; i++ {
+		if !b.take(now) {
+			t.Fatalf("take %d failed with tokens left", i)
+		}
+	}
+	if b.take(now) {
+		t.Fatal("take succeeded on an empty bucket")
+	}
+	if d := b.delay(now); d != 100*time.Millisecond {
+		t.Fatalf("delay() = %v, want 100ms at 10/s", d)
+	}
+	if !b.take(now.Add(100 * time.Millisecond)) {
+		t.Fatal("take failed once a token was due")
+	}
+	b.refill(now.Add(time.Hour))
+	if b.tokens != 2 {
+		t.Fatalf("bucket refilled to %v, want its burst of 2", b.tokens)
+	}
+}
@@ -0,0 +1,98 @@
+package concpool
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Errors returns the errors of the unsuccessful results, in order.
+// Cancelled tasks count as unsuccessful.
+func Errors(results []TaskResult) []error {
+	var errs []error
+	for _, r := range results {
+		if !r.Success {
+			errs = append(errs, r.Err)
+		}
+	}
+	return errs
+}
+
+// Successes returns the results of the tasks that succeeded, in order.
+func Successes(results []TaskResult) []TaskResult {
+	var ok []TaskResult
+	for _, r := range results {
+		if r.Success {
+			ok = append(ok, r)
+		}
+	}
+	return ok
+}
+
+// HasErrors reports whether any of the results is unsuccessful.
+func HasErrors(results []TaskResult) bool {
+	for _, r := range results {
+		if !r.Success {
+			return true
+		}
+	}
+	return false
+}
+
+// FirstError returns the error of the first unsuccessful result, or nil if
+// every task succeeded.
+func FirstError(results []TaskResult) error {
+	for _, r := range results {
+		if !r.Success {
+			return r.Err
+		}
+	}
+	return nil
+}
+
+// MultiError aggregates the errors of a batch of tasks. It is returned by
+// CollectErrors, and works with errors.Is and errors.As through Unwrap.
+type MultiError struct {
+	// Errors holds the error of every failed task, in result order. An
+	// entry is nil for a task that failed without an error, as a
+	// WithResultTransform function can arrange.
+	Errors []error
+	// Total is the number of tasks in the batch, failed or not.
+	Total int
+}
+
+func (e *MultiError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		if err == nil {
+			msgs[i] = "task failed without an error"
+			continue
+		}
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d of %d tasks failed: %s", len(e.Errors), e.Total, strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the aggregated errors.
+func (e *MultiError) Unwrap() []error {
+	return e.Errors
+}
+
+// CollectErrors returns a *MultiError holding the errors of every
+// unsuccessful result, or nil if every task succeeded.
+func CollectErrors(results []TaskResult) error {
+	errs := Errors(results)
+	if len(errs) == 0 {
+		return nil
+	}
+	return &MultiError{Errors: errs, Total: len(results)}
+}
+
+// Must panics with a *MultiError holding every failure if any of results is
+// unsuccessful. It is meant for scripts and tests that treat a failed task
+// as fatal; never use it in server code, where one bad task would take down
+// the process.
+func Must(results []TaskResult) {
+	if err := CollectErrors(results); err != nil {
+		panic(err)
+	}
+}
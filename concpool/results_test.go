@@ -0,0 +1,114 @@
+package concpool
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResultHelpers(t *testing.T) {
+	errA, errB := errors.New("a"), errors.New("b")
+	ok := TaskResult{ID: 1, Success: true}
+	failA := TaskResult{ID: 2, Err: errA}
+	failB := TaskResult{ID: 3, Err: errB}
+	failNil := TaskResult{ID: 4}
+	tests := []struct {
+		name      string
+		results   []TaskResult
+		errs      []error
+		successes int
+		first     error
+		message   string
+	}{
+		{"none", nil, nil, 0, nil, ""},
+		{"all succeed", []TaskResult{ok, ok}, nil, 2, nil, ""},
+		{"some fail", []TaskResult{ok, failA, ok, failB}, []error{errA, errB}, 2, errA, "2 of 4 tasks failed: a; b"},
+		{"all fail", []TaskResult{failB}, []error{errB}, 0, errB, "1 of 1 tasks failed: b"},
+		{"fail without an error", []TaskResult{failNil, failA}, []error{nil, errA}, 0, nil, "2 of 2 tasks failed: task failed without an error; a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := Errors(tt.results)
+			if len(errs) != len(tt.errs) {
+				t.Fatalf("Errors() = %v, want %v", errs, tt.errs)
+			}
+			for i := range errs {
+				if errs[i] != tt.errs[i] {
+					t.Fatalf("Errors() = %v, want %v", errs, tt.errs)
+				}
+			}
+			if n := len(Successes(tt.results)); n != tt.successes {
+				t.Errorf("Successes() returned %d results, want %d", n, tt.successes)
+			}
+			if got := HasErrors(tt.results); got != (len(tt.errs) > 0) {
+				t.Errorf("HasErrors() = %v", got)
+			}
+			if got := FirstError(tt.results); got != tt.first {
+				t.Errorf("FirstError() = %v, want %v", got, tt.first)
+			}
+
+			err := CollectErrors(tt.results)
+			if tt.message == "" {
+				if err != nil {
+					t.Fatalf("CollectErrors() = %v, want nil", err)
+				}
+				return
+			}
+			var me *MultiError
+			if !errors.As(err, &me) || err.Error() != tt.message {
+				t.Fatalf("CollectErrors() = %v, want a *MultiError %q", err, tt.message)
+			}
+			for _, want := range tt.errs {
+				if want != nil && !errors.Is(err, want) {
+					t.Errorf("CollectErrors() does not wrap %v", want)
+				}
+			}
+		})
+	}
+}
+
+func TestMust(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name      string
+		tasks     []func() error
+		wantPanic bool
+	}{
+		{"all succeed", []func() error{func() error { return nil }, func() error { return nil }}, false},
+		{"one fails", []func() error{func() error { return nil }, func() error { return errFailed }}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := func(name string, call func()) {
+				t.Helper()
+				defer func() {
+					v := recover()
+					if (v != nil) != tt.wantPanic {
+						t.Fatalf("%s panicked with %v, want panic: %v", name, v, tt.wantPanic)
+					}
+					if v == nil {
+						return
+					}
+					err, ok := v.(error)
+					var me *MultiError
+					if !ok || !errors.As(err, &me) || !errors.Is(err, errFailed) {
+						t.Fatalf("%s panicked with %#v, want a *MultiError", name, v)
+					}
+				}()
+				call()
+			}
+
+			p := NewSimple(2)
+			p.RunAll(tt.tasks)
+			check("Pool.Must", func() {
+				if results := p.Must(); len(results) != len(tt.tasks) {
+					t.Errorf("Pool.Must() returned %d results, want %d", len(results), len(tt.tasks))
+				}
+			})
+
+			q := NewSimple(2)
+			q.RunAll(tt.tasks)
+			results := q.Wait()
+			check("Must", func() { Must(results) })
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package concpool
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// defaultRetryDelay is the pause between attempts for RunWithRetry.
+const defaultRetryDelay = 10 * time.Millisecond
+
+// RetryOptions controls how RunWithBackoff retries a failing task.
+type RetryOptions struct {
+	// MaxAttempts is the total number of times the task may run,
+	// including the first. Values below 1 are treated as 1.
+	MaxAttempts int
+	// InitialDelay is the pause before the second attempt.
+	InitialDelay time.Duration
+	// Multiplier scales the delay after every attempt. Values below 1 are
+	// treated as 1, which keeps the delay constant.
+	Multiplier float64
+	// MaxDelay caps the delay between attempts. Zero means no cap.
+	MaxDelay time.Duration
+}
+
+// delay returns how long to wait after the given (1-based) failed attempt.
+// The result is jittered to somewhere between half and all of the
+// exponential backoff value so that many retrying tasks don't line up.
+func (o RetryOptions) delay(attempt int) time.Duration {
+	d := float64(o.InitialDelay)
+	if o.Multiplier > 1 {
+		for i := 1; i < attempt; i++ {
+			d *= o.Multiplier
+			if o.MaxDelay > 0 && d >= float64(o.MaxDelay) {
+				break
+			}
+		}
+	}
+	if o.MaxDelay > 0 && d > float64(o.MaxDelay) {
+		d = float64(o.MaxDelay)
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(d/2 + rand.Float64()*d/2)
+}
+
+// RunWithRetry submits a task that is retried after a short pause, up to
+// maxAttempts runs in total, for as long as it returns an error. The
+// TaskResult reflects the last attempt and records how many were made.
+func (p *Pool) RunWithRetry(maxAttempts int, task func() error) uint64 {
+	return p.RunWithBackoff(task, RetryOptions{MaxAttempts: maxAttempts, InitialDelay: defaultRetryDelay})
+}
+
+// RunWithBackoff is like RunWithRetry but waits between attempts using
+// exponential backoff with jitter, as configured by opts. The task keeps
+// its worker slot while it waits. Retrying stops early if the pool is
+// cancelled.
+func (p *Pool) RunWithBackoff(task func() error, opts RetryOptions) uint64 {
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 1
+	}
+	return p.submit(&job{fn: task, retry: &opts})
+}
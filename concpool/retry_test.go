@@ -0,0 +1,62 @@
+package concpool
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunWithRetry(t *testing.T) {
+	errFlaky := errors.New("flaky")
+	p := NewSimple(2)
+	var calls atomic.Int32
+	flaky := p.RunWithRetry(5, func() error {
+		if calls.Add(1) < 3 {
+			return errFlaky
+		}
+		return nil
+	})
+	broken := p.RunWithBackoff(func() error { return errFlaky }, RetryOptions{
+		MaxAttempts:  4,
+		InitialDelay: time.Millisecond,
+		Multiplier:   2,
+		MaxDelay:     3 * time.Millisecond,
+	})
+	plain := p.Run(func() error { return nil })
+
+	results := p.WaitMap()
+	if r := results[flaky]; !r.Success || r.Attempts != 3 {
+		t.Errorf("flaky task: got %+v, want success on attempt 3", r)
+	}
+	if r := results[broken]; r.Success || !errors.Is(r.Err, errFlaky) || r.Attempts != 4 {
+		t.Errorf("broken task: got %+v, want failure after 4 attempts", r)
+	}
+	if r := results[plain]; r.Attempts != 1 {
+		t.Errorf("plain task: got %d attempts, want 1", r.Attempts)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    RetryOptions
+		attempt int
+		want    time.Duration // the delay before jitter
+	}{
+		{"first attempt", RetryOptions{InitialDelay: 10 * time.Millisecond, Multiplier: 2}, 1, 10 * time.Millisecond},
+		{"grows", RetryOptions{InitialDelay: 10 * time.Millisecond, Multiplier: 2}, 3, 40 * time.Millisecond},
+		{"capped", RetryOptions{InitialDelay: 10 * time.Millisecond, Multiplier: 2, MaxDelay: 25 * time.Millisecond}, 3, 25 * time.Millisecond},
+		{"constant", RetryOptions{InitialDelay: 10 * time.Millisecond}, 5, 10 * time.Millisecond},
+		{"no delay", RetryOptions{Multiplier: 2}, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if d := tt.opts.delay(tt.attempt); d < tt.want/2 || d > tt.want {
+					t.Fatalf("delay(%d) = %v, want between %v and %v", tt.attempt, d, tt.want/2, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package concpool
+
+import (
+	"sync"
+	"time"
+)
+
+// ScheduledTask is a task waiting to be submitted by RunAfter. Its methods
+// are safe to call from any goroutine.
+type ScheduledTask struct {
+	timer *time.Timer
+	task  func() error
+	stack []uintptr
+
+	mu        sync.Mutex
+	cancelled bool
+	id        uint64
+}
+
+// RunAfter submits task to the pool once delay has elapsed, as if Run were
+// called at that point, and returns a handle that can cancel it until then.
+//
+// A task that hasn't been submitted yet is not part of the pool's work: Wait
+// doesn't wait for it. If it comes due after Wait has returned, it is held
+// until Reset and submitted to the next batch, getting its ID then; use Hold
+// to keep Wait waiting for scheduled tasks instead. A task whose timer fires
+// after Shutdown is silently dropped.
+func (p *Pool) RunAfter(delay time.Duration, task func() error) *ScheduledTask {
+	st := &ScheduledTask{task: task, stack: p.captureStack(1)}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.timer = time.AfterFunc(delay, func() { st.submit(p) })
+	return st
+}
+
+// submit hands the task to p unless it has been cancelled.
+func (st *ScheduledTask) submit(p *Pool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.cancelled {
+		return
+	}
+	st.id = p.submitScheduled(st)
+}
+
+// submitScheduled queues st's task and returns its ID, or returns 0 if the
+// pool is shutting down or has terminated, holding it for the next batch in
+// the latter case. The checks and the enqueue happen under one lock, so a
+// concurrent Shutdown can't slip in between them.
+func (p *Pool) submitScheduled(st *ScheduledTask) uint64 {
+	p.lazyInit()
+	p.mu.Lock()
+	if p.overflow == overflowBlock {
+		p.waitForRoom()
+	}
+	if p.shuttingDown {
+		p.mu.Unlock()
+		return 0
+	}
+	if p.terminated {
+		p.late = append(p.late, st)
+		p.mu.Unlock()
+		return 0
+	}
+
+	t := &job{fn: st.task, id: p.lastID.Add(1), stack: st.stack}
+	p.counts.submitted.Add(1)
+	queued := p.enqueue(t) && p.observed()
+	depth := p.queue.len()
+	p.mu.Unlock()
+
+	if queued {
+		p.logSubmitted(t, depth)
+	}
+	p.attemptCheck()
+	return t.id
+}
+
+// Cancel prevents the task from being submitted and reports whether it
+// did; it returns false if the task has already been submitted.
+func (st *ScheduledTask) Cancel() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.id != 0 {
+		return false
+	}
+	st.cancelled = true
+	st.timer.Stop()
+	return true
+}
+
+// ID returns the task's ID once it has been submitted, or 0 before that.
+func (st *ScheduledTask) ID() uint64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.id
+}
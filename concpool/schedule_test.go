@@ -0,0 +1,101 @@
+package concpool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunAfter(t *testing.T) {
+	// one task at a time, so they run in the order they were submitted
+	p := NewSimple(1)
+	release := p.Hold()
+	var mu sync.Mutex
+	var order []time.Duration
+	delays := []time.Duration{40, 10, 30, 20, 50}
+	scheduled := make([]*ScheduledTask, len(delays))
+	var ran sync.WaitGroup
+	for i, d := range delays {
+		d *= time.Millisecond
+		ran.Add(1)
+		scheduled[i] = p.RunAfter(d, func() error {
+			defer ran.Done()
+			mu.Lock()
+			order = append(order, d)
+			mu.Unlock()
+			return nil
+		})
+	}
+	cancelled := p.RunAfter(20*time.Millisecond, func() error {
+		t.Error("cancelled task ran")
+		return nil
+	})
+	if !cancelled.Cancel() || cancelled.ID() != 0 {
+		t.Fatal("Cancel() failed before the timer fired")
+	}
+	go func() { ran.Wait(); release() }()
+
+	if results := p.Wait(); len(results) != len(delays) {
+		t.Fatalf("got %d results, want %d", len(results), len(delays))
+	}
+	for i, d := range order {
+		if want := time.Duration(i+1) * 10 * time.Millisecond; d != want {
+			t.Fatalf("tasks ran in the order of delays %v, want shortest first", order)
+		}
+	}
+	for _, st := range scheduled {
+		if st.Cancel() || st.ID() == 0 {
+			t.Error("task is still cancellable after it was submitted")
+		}
+	}
+}
+
+func TestRunAfterWait(t *testing.T) {
+	p := NewSimple(1)
+	var ran atomic.Bool
+	st := p.RunAfter(20*time.Millisecond, func() error { ran.Store(true); return nil })
+	dropped := p.RunAfter(20*time.Millisecond, func() error {
+		t.Error("task cancelled while held for the next batch ran")
+		return nil
+	})
+	start := time.Now()
+	if results := p.Wait(); len(results) != 0 || time.Since(start) > 10*time.Millisecond {
+		t.Fatalf("Wait() = %d results after %v, want it not to wait for the timer", len(results), time.Since(start))
+	}
+
+	// both timers fire into the terminated pool, which holds the tasks
+	time.Sleep(60 * time.Millisecond)
+	if st.ID() != 0 || p.Stats().Submitted != 0 {
+		t.Fatalf("task came due after Wait but was submitted to the finished batch as %d", st.ID())
+	}
+	if !dropped.Cancel() {
+		t.Fatal("Cancel() failed for a task held for the next batch")
+	}
+
+	p.Reset()
+	if st.ID() != 1 {
+		t.Fatalf("ID() = %d after Reset, want 1", st.ID())
+	}
+	results := p.Wait()
+	if len(results) != 1 || !results[0].Success || !ran.Load() {
+		t.Fatalf("Wait() after Reset = %+v, want the held task to run", results)
+	}
+}
+
+func TestRunAfterShutdown(t *testing.T) {
+	p := NewSimple(1)
+	st := p.RunAfter(10*time.Millisecond, func() error {
+		t.Error("task that came due after Shutdown ran")
+		return nil
+	})
+	if _, err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+	// a panic in the timer's goroutine would crash the test binary
+	time.Sleep(30 * time.Millisecond)
+	if st.ID() != 0 {
+		t.Fatalf("ID() = %d, want the task dropped", st.ID())
+	}
+}
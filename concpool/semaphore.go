@@ -0,0 +1,98 @@
+package concpool
+
+// Semaphore limits how many goroutines may be inside a section of code at
+// once. Acquire blocks until a slot is free, TryAcquire takes one only if
+// it is free right away, and Release gives a slot back.
+type Semaphore interface {
+	Acquire()
+	TryAcquire() bool
+	Release()
+}
+
+// NewSemaphore returns a standalone Semaphore with n slots. Values below 1
+// are treated as 1.
+func NewSemaphore(n int) Semaphore {
+	if n < 1 {
+		n = 1
+	}
+	return make(chanSemaphore, n)
+}
+
+// chanSemaphore is a Semaphore whose buffered slots are the held slots.
+type chanSemaphore chan struct{}
+
+func (s chanSemaphore) Acquire() {
+	s <- struct{}{}
+}
+
+func (s chanSemaphore) TryAcquire() bool {
+	select {
+	case s <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s chanSemaphore) Release() {
+	select {
+	case <-s:
+	default:
+		panic("concpool: Release called without Acquire")
+	}
+}
+
+// Semaphore returns a Semaphore that shares the pool's concurrency limit
+// with its tasks, for work that doesn't fit the task model. A held slot
+// counts as a running task: queued tasks wait for it to be released, it
+// shows up in Running and Stats, and Wait doesn't return while it is held.
+// Acquire competes with queued tasks for free slots, and a worker that
+// finishes a task hands its slot to the next queued task first, so on a
+// busy pool Acquire may wait until the queue is empty.
+func (p *Pool) Semaphore() Semaphore {
+	p.lazyInit()
+	return poolSemaphore{p}
+}
+
+type poolSemaphore struct {
+	p *Pool
+}
+
+func (s poolSemaphore) Acquire() {
+	p := s.p
+	p.mu.Lock()
+	for p.running >= p.maxCount {
+		p.slotFreed.Wait()
+	}
+	p.running++
+	p.semHeld++
+	p.mu.Unlock()
+}
+
+func (s poolSemaphore) TryAcquire() bool {
+	p := s.p
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running >= p.maxCount {
+		return false
+	}
+	p.running++
+	p.semHeld++
+	return true
+}
+
+func (s poolSemaphore) Release() {
+	p := s.p
+	p.mu.Lock()
+	if p.semHeld == 0 {
+		p.mu.Unlock()
+		panic("concpool: Release called without Acquire")
+	}
+	p.semHeld--
+	p.running--
+	p.slotFreed.Signal()
+	p.mu.Unlock()
+
+	// the slot may let a queued task start, or the pool terminate
+	p.attemptCheck()
+}
@@ -0,0 +1,90 @@
+package concpool
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSemaphore(t *testing.T) {
+	const n = 3
+	tests := []struct {
+		name string
+		sem  func() Semaphore
+	}{
+		{"standalone", func() Semaphore { return NewSemaphore(n) }},
+		{"pool", func() Semaphore { return NewSimple(n).Semaphore() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sem := tt.sem()
+			var inside, peak atomic.Int32
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					sem.Acquire()
+					defer sem.Release()
+					cur := inside.Add(1)
+					for old := peak.Load(); cur > old && !peak.CompareAndSwap(old, cur); old = peak.Load() {
+					}
+					time.Sleep(time.Millisecond)
+					inside.Add(-1)
+				}()
+			}
+			wg.Wait()
+			if got := peak.Load(); got != n {
+				t.Fatalf("%d goroutines held the semaphore at once, want %d", got, n)
+			}
+
+			for i := 0; i < n; i++ {
+				if !sem.TryAcquire() {
+					t.Fatalf("TryAcquire %d failed with free slots", i)
+				}
+			}
+			if sem.TryAcquire() {
+				t.Fatal("TryAcquire succeeded with every slot held")
+			}
+			for i := 0; i < n; i++ {
+				sem.Release()
+			}
+		})
+	}
+}
+
+func TestPoolSemaphoreSharesLimit(t *testing.T) {
+	p := NewSimple(2)
+	sem := p.Semaphore()
+	sem.Acquire()
+	sem.Acquire()
+	var ran atomic.Bool
+	p.Run(func() error { ran.Store(true); return nil })
+	done := make(chan struct{})
+	go func() { p.Wait(); close(done) }()
+
+	time.Sleep(20 * time.Millisecond)
+	if ran.Load() || p.Running() != 2 {
+		t.Fatalf("task ran with every slot held by the semaphore (Running() = %d)", p.Running())
+	}
+	sem.Release()
+	sem.Release()
+	<-done
+	if !ran.Load() {
+		t.Fatal("task did not run once the slots were released")
+	}
+}
+
+func TestSemaphoreReleaseWithoutAcquire(t *testing.T) {
+	for name, sem := range map[string]Semaphore{"standalone": NewSemaphore(1), "pool": NewSimple(1).Semaphore()} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: Release without Acquire did not panic", name)
+				}
+			}()
+			sem.Release()
+		}()
+	}
+}
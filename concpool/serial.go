@@ -0,0 +1,45 @@
+package concpool
+
+// RunSerial submits tasks as a chain that runs one task at a time, in
+// order, alongside the pool's other work: each task is submitted only once
+// the one before it has succeeded, so it may rely on that task's effects.
+// If a task fails or is cancelled, the rest of the chain is not run; each
+// of them is reported with Skipped and Cancelled set and Err set to
+// ErrSkipped. Tasks are assigned their IDs as they are submitted or
+// skipped, so a chain's IDs need not be consecutive.
+func (p *Pool) RunSerial(tasks ...func() error) {
+	if len(tasks) == 0 {
+		return
+	}
+	p.submit(&job{fn: tasks[0], serial: tasks[1:]})
+}
+
+// continueSerial submits the next task of t's RunSerial chain if t
+// succeeded, or skips the rest of the chain if it didn't. It is called
+// while t still counts as running, so the pool can't terminate before the
+// next task is queued, and it bypasses the Shutdown check so that a
+// graceful shutdown runs the chain to the end.
+func (p *Pool) continueSerial(t *job, succeeded bool) {
+	if !succeeded {
+		p.mu.Lock()
+		p.skip(t.serial)
+		p.mu.Unlock()
+		return
+	}
+
+	next := &job{fn: t.serial[0], serial: t.serial[1:], stack: t.stack}
+	next.id = p.lastID.Add(1)
+	p.counts.submitted.Add(1)
+	p.pushToQueue(next)
+	p.attemptCheck()
+}
+
+// skip reports every task in tasks as skipped. The caller must hold p.mu.
+func (p *Pool) skip(tasks []func() error) {
+	for range tasks {
+		id := p.lastID.Add(1)
+		p.counts.submitted.Add(1)
+		p.counts.cancelled.Add(1)
+		p.dropped = append(p.dropped, TaskResult{ID: id, Index: int(id - 1), Success: false, Err: ErrSkipped, Cancelled: true, Skipped: true})
+	}
+}
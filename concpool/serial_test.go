@@ -0,0 +1,68 @@
+package concpool
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunSerial(t *testing.T) {
+	errFailed := errors.New("failed")
+	p := NewSimple(4)
+	var mu sync.Mutex
+	var order []string
+	step := func(name string, err error) func() error {
+		return func() error {
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			return err
+		}
+	}
+	p.RunSerial(step("a1", nil), step("a2", errFailed), step("a3", nil))
+	p.RunSerial(step("b1", nil), step("b2", nil), step("b3", nil))
+	p.Run(step("c", nil))
+	results := p.Wait()
+
+	if len(results) != 7 {
+		t.Fatalf("Wait() = %d results, want 7", len(results))
+	}
+	var failed, skipped int
+	for _, r := range results {
+		switch {
+		case r.Skipped:
+			skipped++
+			if !r.Cancelled || !errors.Is(r.Err, ErrSkipped) {
+				t.Errorf("skipped task: got %+v, want Cancelled with ErrSkipped", r)
+			}
+		case errors.Is(r.Err, errFailed):
+			failed++
+		case !r.Success:
+			t.Errorf("task %d: unexpected error %v", r.ID, r.Err)
+		}
+	}
+	if failed != 1 || skipped != 1 {
+		t.Errorf("got %d failed and %d skipped, want 1 and 1", failed, skipped)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if slices.Contains(order, "a3") {
+		t.Error("the task after the failure ran")
+	}
+	// each chain runs in order, whatever the other tasks do
+	for _, chain := range [][]string{{"a1", "a2"}, {"b1", "b2", "b3"}} {
+		var got []string
+		for _, name := range order {
+			if slices.Contains(chain, name) {
+				got = append(got, name)
+			}
+		}
+		if !slices.Equal(got, chain) {
+			t.Errorf("chain ran in order %v, want %v", got, chain)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package concpool
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// ShardedPool runs tasks in parallel while keeping the tasks for any one key
+// in order. It is made of a fixed number of shards, each a Pool that runs
+// one task at a time; RunKeyed hashes the key to pick the shard, so tasks
+// with the same key always run one after another in submission order, and
+// tasks with keys on different shards run concurrently. Tasks start as
+// soon as they are submitted, without the pool being waited on.
+type ShardedPool struct {
+	shards []*Pool
+	// groups holds each shard's tasks, so they can start without the
+	// shard being waited on.
+	groups []*TaskGroup
+}
+
+// NewShardedPool creates a ShardedPool with the given number of shards
+// (at least 1). maxPerShard bounds how many tasks may wait in each shard's
+// queue; once a shard's queue is full, RunKeyed blocks until its running
+// task finishes and makes room, as with WithOverflowBlock, so a task is
+// never rejected after an earlier one for its key. 0 leaves the queues
+// unbounded.
+func NewShardedPool(shards, maxPerShard int) *ShardedPool {
+	if shards < 1 {
+		shards = 1
+	}
+	sp := &ShardedPool{shards: make([]*Pool, shards), groups: make([]*TaskGroup, shards)}
+	for i := range sp.shards {
+		sp.shards[i] = New(WithMaxConcurrency(1), WithMaxQueue(maxPerShard), WithOverflowBlock())
+		sp.groups[i] = sp.shards[i].Group()
+	}
+	return sp
+}
+
+// RunKeyed submits task to the shard that key maps to. Tasks with the same
+// key run in the order they were submitted and never overlap. If the
+// shard's queue is full, RunKeyed waits for room.
+func (sp *ShardedPool) RunKeyed(key string, task func() error) {
+	sp.groups[sp.shard(key)].Run(task)
+}
+
+// Wait blocks until every shard has finished its tasks and returns all the
+// results, grouped by shard and in completion order within each shard.
+// IDs and indices are assigned per shard, so they are only unique within
+// the results of one shard. Like a Pool, the ShardedPool doesn't run tasks
+// submitted after Wait has returned.
+func (sp *ShardedPool) Wait() []TaskResult {
+	perShard := make([][]TaskResult, len(sp.shards))
+	var wg sync.WaitGroup
+	for i, p := range sp.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			perShard[i] = sp.groups[i].Wait()
+			// end the shard's batch so its worker exits
+			p.Wait()
+		}()
+	}
+	wg.Wait()
+
+	var results []TaskResult
+	for _, r := range perShard {
+		results = append(results, r...)
+	}
+	return results
+}
+
+// waitAll waits for all pools at once and returns their results pool by
+// pool.
+func waitAll(pools []*Pool) []TaskResult {
+	var results []TaskResult
+	for _, r := range waitEach(pools) {
+		results = append(results, r...)
+	}
+	return results
+}
+
+// waitEach waits for all pools at once, since each only makes progress
+// while it is being waited on, and returns each pool's results at its
+// index.
+func waitEach(pools []*Pool) [][]TaskResult {
+	perPool := make([][]TaskResult, len(pools))
+	var wg sync.WaitGroup
+	for i, p := range pools {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			perPool[i] = p.Wait()
+		}()
+	}
+	wg.Wait()
+	return perPool
+}
+
+// shard returns the index of the shard that runs the tasks for key.
+func (sp *ShardedPool) shard(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(sp.shards)))
+}
@@ -0,0 +1,105 @@
+package concpool
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sameShardKeys returns two distinct keys that sp maps to the same shard.
+func sameShardKeys(t *testing.T, sp *ShardedPool) (string, string) {
+	t.Helper()
+	seen := map[int]string{}
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		shard := sp.shard(key)
+		if other, ok := seen[shard]; ok {
+			return other, key
+		}
+		seen[shard] = key
+	}
+	t.Fatal("no two keys share a shard")
+	return "", ""
+}
+
+func TestShardedPoolOrdering(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxPerShard int
+	}{
+		{"unbounded", 0},
+		{"bounded", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := NewShardedPool(4, tt.maxPerShard)
+			a, b := sameShardKeys(t, sp)
+
+			const perKey = 50
+			var mu sync.Mutex
+			got := map[string][]int{}
+			for i := 0; i < perKey; i++ {
+				for _, key := range []string{a, b, "other"} {
+					sp.RunKeyed(key, func() error {
+						if i%10 == 0 {
+							time.Sleep(time.Millisecond)
+						}
+						mu.Lock()
+						got[key] = append(got[key], i)
+						mu.Unlock()
+						return nil
+					})
+				}
+			}
+
+			results := sp.Wait()
+			if len(results) != 3*perKey {
+				t.Fatalf("Wait() returned %d results, want %d", len(results), 3*perKey)
+			}
+			for _, r := range results {
+				if !r.Success {
+					t.Fatalf("task failed: %v", r.Err)
+				}
+			}
+			for key, order := range got {
+				if len(order) != perKey {
+					t.Fatalf("key %s ran %d tasks, want %d", key, len(order), perKey)
+				}
+				for i, n := range order {
+					if n != i {
+						t.Fatalf("key %s ran its tasks in order %v", key, order)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestShardedPoolBoundBlocks(t *testing.T) {
+	sp := NewShardedPool(1, 1)
+	release := make(chan struct{})
+	sp.RunKeyed("k", func() error { <-release; return nil })
+	// wait for the first task to start so the second fills the queue
+	for sp.shards[0].Running() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	sp.RunKeyed("k", func() error { return nil })
+
+	submitted := make(chan struct{})
+	go func() {
+		sp.RunKeyed("k", func() error { return nil })
+		close(submitted)
+	}()
+	select {
+	case <-submitted:
+		t.Fatal("RunKeyed did not block on a full shard")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	<-submitted
+	if results := sp.Wait(); len(results) != 3 || HasErrors(results) {
+		t.Fatalf("Wait() = %+v, want three successes", results)
+	}
+}
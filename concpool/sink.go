@@ -0,0 +1,80 @@
+package concpool
+
+// defaultResultCallbackBuffer is the WithResultCallbackBuffer default.
+const defaultResultCallbackBuffer = 100
+
+// resultSink is the goroutine that runs the OnResultBlocking callback,
+// fed through a buffered channel. Like a workerSet, it is started when the
+// first result arrives and retired when the pool terminates.
+type resultSink struct {
+	results chan TaskResult
+	quit    chan struct{}
+}
+
+// OnResultBlocking registers fn to be called with the result of every task
+// that runs, like OnComplete, but from a goroutine of its own, one result
+// at a time, for callbacks that write to a database or another slow sink.
+// Results wait for fn in a buffer of WithResultCallbackBuffer entries; once
+// it is full, workers block until fn catches up, so a slow fn slows the
+// pool down instead of results piling up or being dropped. Wait returns
+// only after fn has returned for every result. A later call replaces the
+// callback; pass nil to remove it.
+//
+// fn must not wait on the pool. Submitting more work with Run is fine,
+// since Run doesn't block (unless the pool was created with
+// WithOverflowBlock), but calling Wait or Flush from fn, or RunBounded on a
+// full queue, deadlocks: the workers that would make progress are blocked
+// on fn.
+func (p *Pool) OnResultBlocking(fn func(TaskResult)) {
+	p.lazyInit()
+	p.mu.Lock()
+	p.onResultBlocking = fn
+	p.mu.Unlock()
+}
+
+// resultSink returns the running sink, starting it if needed. The caller
+// must hold p.mu.
+func (p *Pool) resultSink() *resultSink {
+	if p.sink == nil {
+		s := &resultSink{
+			results: make(chan TaskResult, p.sinkBuffer),
+			quit:    make(chan struct{}),
+		}
+		p.sink = s
+		p.spawn(func() { p.runSink(s) })
+	}
+	return p.sink
+}
+
+// sinkResult hands r to s, blocking while its buffer is full.
+func (p *Pool) sinkResult(s *resultSink, r TaskResult) {
+	select {
+	case s.results <- r:
+	case <-s.quit:
+	}
+}
+
+// runSink calls the OnResultBlocking callback for each result s receives,
+// until s is retired.
+func (p *Pool) runSink(s *resultSink) {
+	for {
+		select {
+		case r := <-s.results:
+			p.mu.Lock()
+			fn := p.onResultBlocking
+			p.mu.Unlock()
+			if fn != nil {
+				fn(r)
+			}
+
+			p.mu.Lock()
+			if p.sink == s {
+				p.sinkPending--
+			}
+			p.mu.Unlock()
+			p.attemptCheck()
+		case <-s.quit:
+			return
+		}
+	}
+}
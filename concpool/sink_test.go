@@ -0,0 +1,51 @@
+package concpool
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOnResultBlocking(t *testing.T) {
+	const workers, buffer, tasks = 4, 2, 50
+	p := New(WithMaxConcurrency(workers), WithResultCallbackBuffer(buffer))
+	var started, handled atomic.Int32
+	var backlog, goroutines atomic.Int32
+	p.OnResultBlocking(func(TaskResult) {
+		time.Sleep(2 * time.Millisecond)
+		n := handled.Add(1)
+		backlog.Store(max(backlog.Load(), started.Load()-n))
+		goroutines.Store(max(goroutines.Load(), int32(p.Stats().Goroutines)))
+	})
+	for i := 0; i < tasks; i++ {
+		p.Run(func() error { started.Add(1); return nil })
+	}
+	start := time.Now()
+	results := p.Wait()
+
+	if len(results) != tasks || handled.Load() != tasks {
+		t.Fatalf("Wait() = %d results with %d handled, want %d of each", len(results), handled.Load(), tasks)
+	}
+	// the slow callback holds the workers back: at most the buffer, a
+	// worker each and the result being handled are ahead of it
+	if n := backlog.Load(); n > buffer+workers+1 {
+		t.Errorf("tasks ran up to %d results ahead of the callback, want at most %d", n, buffer+workers+1)
+	}
+	if n := goroutines.Load(); n > workers+1 {
+		t.Errorf("pool ran %d goroutines, want at most %d workers and the callback", n, workers+1)
+	}
+	if d := time.Since(start); d < tasks*2*time.Millisecond {
+		t.Errorf("Wait() returned after %v, before the callback could handle every result", d)
+	}
+	if n := waitGoroutines(p, 0); n != 0 {
+		t.Errorf("%d goroutines left after Wait", n)
+	}
+
+	// the callback stays registered across Reset
+	p.Reset()
+	p.Run(func() error { started.Add(1); return nil })
+	p.Wait()
+	if n := handled.Load(); n != tasks+1 {
+		t.Errorf("callback handled %d results after Reset, want %d", n, tasks+1)
+	}
+}
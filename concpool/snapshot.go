@@ -0,0 +1,67 @@
+package concpool
+
+import (
+	"encoding/json"
+	"io"
+	"slices"
+)
+
+// PoolSnapshot is a point-in-time view of what a pool is doing, as returned
+// by Snapshot.
+type PoolSnapshot struct {
+	// QueueDepth and Running are the number of tasks waiting to start and
+	// running right now. Running counts tasks, not the weighted slots
+	// reported by Running.
+	QueueDepth int `json:"queue_depth"`
+	Running    int `json:"running"`
+	// Submitted, Completed, Failed and Cancelled are as in PoolStats.
+	Submitted int `json:"submitted"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+	Cancelled int `json:"cancelled"`
+	// PendingIDs and RunningIDs are the IDs of the queued and running
+	// tasks, in ascending order.
+	PendingIDs []uint64 `json:"pending_ids"`
+	RunningIDs []uint64 `json:"running_ids"`
+}
+
+// Snapshot returns a copy of the pool's queue and running state, taken
+// under the pool's lock so the two are consistent with each other. It walks
+// the whole queue and is meant for diagnosing a stuck pool; use Stats for
+// routine monitoring. The counters are updated as tasks finish, a moment
+// before they leave RunningIDs, so a snapshot taken while tasks are in
+// flight may count a task or two twice.
+func (p *Pool) Snapshot() PoolSnapshot {
+	p.lazyInit()
+	p.mu.Lock()
+	pending := make([]uint64, 0, p.queue.len())
+	p.queue.each(func(t *job) { pending = append(pending, t.id) })
+	running := p.inflightIDs()
+	p.mu.Unlock()
+	slices.Sort(pending)
+	slices.Sort(running)
+
+	return PoolSnapshot{
+		QueueDepth: len(pending),
+		Running:    len(running),
+		Submitted:  int(p.counts.submitted.Load()),
+		Completed:  int(p.counts.completed.Load()),
+		Failed:     int(p.counts.failed.Load()),
+		Cancelled:  int(p.counts.cancelled.Load()),
+		PendingIDs: pending,
+		RunningIDs: running,
+	}
+}
+
+// DumpState writes the pool's Snapshot to w as indented JSON, preceded by
+// the pool's name, for logging or printing from a debug handler.
+func (p *Pool) DumpState(w io.Writer) error {
+	state := struct {
+		Name string `json:"name"`
+		PoolSnapshot
+	}{p.Name(), p.Snapshot()}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(state)
+}
@@ -0,0 +1,57 @@
+package concpool
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	p := New(WithMaxConcurrency(3), WithName("snap"))
+	gate := make(chan struct{})
+	p.Run(func() error { return nil })
+	p.Run(func() error { return errors.New("failed") })
+	for i := 0; i < 10; i++ {
+		p.Run(func() error { <-gate; return nil })
+	}
+	done := make(chan []TaskResult)
+	go func() { done <- p.Wait() }()
+	defer func() { close(gate); <-done }()
+
+	var s PoolSnapshot
+	deadline := time.Now().Add(5 * time.Second)
+	for s = p.Snapshot(); (s.Running < 3 || s.Completed+s.Failed < 2) && time.Now().Before(deadline); s = p.Snapshot() {
+		time.Sleep(time.Millisecond)
+	}
+	if s.Running != 3 || s.Completed != 1 || s.Failed != 1 {
+		t.Fatalf("Snapshot() = %+v, want 3 running, 1 completed and 1 failed", s)
+	}
+	if s.Running+s.QueueDepth != s.Submitted-s.Completed-s.Failed {
+		t.Errorf("Snapshot() = %+v: running + queued != submitted - finished", s)
+	}
+	if len(s.RunningIDs) != s.Running || len(s.PendingIDs) != s.QueueDepth || s.QueueDepth != 7 {
+		t.Errorf("Snapshot() = %+v, want 7 queued and the IDs to match the counts", s)
+	}
+	if want := []uint64{3, 4, 5}; !slices.Equal(s.RunningIDs, want) {
+		t.Errorf("RunningIDs = %v, want %v", s.RunningIDs, want)
+	}
+
+	var buf bytes.Buffer
+	if err := p.DumpState(&buf); err != nil {
+		t.Fatalf("DumpState() error = %v", err)
+	}
+	var dumped struct {
+		Name       string   `json:"name"`
+		QueueDepth int      `json:"queue_depth"`
+		PendingIDs []uint64 `json:"pending_ids"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &dumped); err != nil {
+		t.Fatalf("DumpState() wrote invalid JSON: %v\n%s", err, buf.String())
+	}
+	if dumped.Name != "snap" || dumped.QueueDepth != 7 || len(dumped.PendingIDs) != 7 {
+		t.Errorf("DumpState() wrote:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,93 @@
+package concpool
+
+import "sync"
+
+// subscriber delivers results to one Subscribe observer on its own
+// goroutine, buffering them so the workers never wait for it.
+type subscriber struct {
+	fn func(TaskResult)
+
+	mu      sync.Mutex
+	pending []TaskResult
+	wake    chan struct{}
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// newSubscriber returns a subscriber for fn; the caller starts its run
+// goroutine.
+func newSubscriber(fn func(TaskResult)) *subscriber {
+	return &subscriber{
+		fn:   fn,
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+	}
+}
+
+// push queues r for the observer without blocking.
+func (s *subscriber) push(r TaskResult) {
+	s.mu.Lock()
+	s.pending = append(s.pending, r)
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscriber) run() {
+	for {
+		select {
+		case <-s.wake:
+		case <-s.stop:
+			return
+		}
+
+		s.mu.Lock()
+		batch := s.pending
+		s.pending = nil
+		s.mu.Unlock()
+
+		for _, r := range batch {
+			select {
+			case <-s.stop:
+				return
+			default:
+			}
+			s.fn(r)
+		}
+	}
+}
+
+// Subscribe registers fn to be called with the result of every task that
+// runs from now on. Unlike OnComplete, fn doesn't run on the worker: each
+// subscriber has a goroutine of its own that calls fn for one result after
+// another, buffering results while fn is busy, so neither the workers nor
+// other subscribers wait for it.
+//
+// The returned cancel function unsubscribes fn and stops its goroutine;
+// results not delivered yet are dropped. It may be called at any time, and
+// more than once. Call it when done, or the goroutine stays around.
+func (p *Pool) Subscribe(fn func(TaskResult)) (cancel func()) {
+	s := newSubscriber(fn)
+	p.spawn(s.run)
+
+	p.mu.Lock()
+	p.subscribers = append(p.subscribers[:len(p.subscribers):len(p.subscribers)], s)
+	p.mu.Unlock()
+
+	return func() {
+		s.once.Do(func() {
+			p.mu.Lock()
+			for i, other := range p.subscribers {
+				if other == s {
+					p.subscribers = append(p.subscribers[:i:i], p.subscribers[i+1:]...)
+					break
+				}
+			}
+			p.mu.Unlock()
+			close(s.stop)
+		})
+	}
+}
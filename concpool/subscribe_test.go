@@ -0,0 +1,71 @@
+package concpool
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	p := NewSimple(4)
+	var mu sync.Mutex
+	seen := make([]map[uint64]bool, 2)
+	for i := range seen {
+		seen[i] = make(map[uint64]bool)
+	}
+	all := make(chan struct{})
+	cancels := make([]func(), 2)
+	for i := range cancels {
+		cancels[i] = p.Subscribe(func(r TaskResult) {
+			mu.Lock()
+			defer mu.Unlock()
+			seen[i][r.ID] = true
+			if i == 0 && len(seen[0]) == 100 {
+				close(all)
+			}
+		})
+	}
+	defer cancels[0]()
+
+	release := make(chan struct{})
+	for j := 0; j < 100; j++ {
+		p.Run(func() error {
+			if j >= 50 {
+				<-release
+			}
+			return nil
+		})
+	}
+	done := make(chan struct{})
+	go func() { p.Wait(); close(done) }()
+
+	// cancel the second subscriber halfway, while Wait is blocked
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(seen[1])
+		mu.Unlock()
+		if n >= 50 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("second subscriber saw %d results, want 50 before cancelling", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancels[1]()
+	cancels[1]()
+	close(release)
+	<-done
+
+	select {
+	case <-all:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("first subscriber did not receive all 100 results")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if n := len(seen[1]); n != 50 {
+		t.Fatalf("cancelled subscriber saw %d results, want it to stop after the first 50", n)
+	}
+}
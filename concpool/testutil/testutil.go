@@ -0,0 +1,42 @@
+// Package testutil provides helpers for tests of code that uses concpool.
+package testutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/almoatamed/go-conc/concpool"
+)
+
+// drainTimeout is how long AssertDrained gives the pool's goroutines to
+// exit after it terminated.
+const drainTimeout = time.Second
+
+// AssertDrained checks that p is finished with its work: it has
+// terminated, nothing is queued or running, and none of the goroutines it
+// started are still alive. Workers exit shortly after a pool terminates,
+// so it waits up to a second for them. Each failed check is reported with
+// t.Errorf. Call it after Wait, typically in a deferred cleanup.
+func AssertDrained(t testing.TB, p *concpool.Pool) {
+	t.Helper()
+
+	s := p.Stats()
+	if !s.Terminated {
+		t.Errorf("concpool: pool %q has not terminated", s.Name)
+	}
+	if s.CurrentPending != 0 {
+		t.Errorf("concpool: pool %q still has %d queued tasks", s.Name, s.CurrentPending)
+	}
+	if s.CurrentRunning != 0 {
+		t.Errorf("concpool: pool %q still has %d running tasks", s.Name, s.CurrentRunning)
+	}
+
+	deadline := time.Now().Add(drainTimeout)
+	for s.Goroutines > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		s = p.Stats()
+	}
+	if s.Goroutines > 0 {
+		t.Errorf("concpool: pool %q leaked %d goroutines", s.Name, s.Goroutines)
+	}
+}
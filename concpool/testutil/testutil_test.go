@@ -0,0 +1,79 @@
+package testutil
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/almoatamed/go-conc/concpool"
+)
+
+// recordingTB captures Errorf calls instead of failing the test.
+type recordingTB struct {
+	testing.TB
+	errs []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+func TestAssertDrained(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	tests := []struct {
+		name string
+		pool func() *concpool.Pool
+		want []string
+	}{
+		{
+			name: "drained",
+			pool: func() *concpool.Pool {
+				p := concpool.New(concpool.WithMaxConcurrency(4))
+				p.RunN(10, func() error { return nil })
+				p.Wait()
+				return p
+			},
+		},
+		{
+			name: "leaked goroutine",
+			pool: func() *concpool.Pool {
+				// the task outlives its timeout, and its goroutine with it
+				p := concpool.New(concpool.WithName("leaky"))
+				p.RunWithTimeout(time.Millisecond, func() error { <-release; return nil })
+				p.Wait()
+				return p
+			},
+			want: []string{`pool "leaky" leaked 1 goroutines`},
+		},
+		{
+			name: "not waited for",
+			pool: func() *concpool.Pool {
+				p := concpool.New()
+				p.Run(func() error { return nil })
+				return p
+			},
+			want: []string{`pool "default" has not terminated`, `pool "default" still has 1 queued tasks`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.pool()
+			rec := &recordingTB{}
+			AssertDrained(rec, p)
+			if len(rec.errs) != len(tt.want) {
+				t.Fatalf("AssertDrained reported %q, want %d failures", rec.errs, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.HasSuffix(rec.errs[i], want) {
+					t.Errorf("failure %d = %q, want %q", i, rec.errs[i], want)
+				}
+			}
+			p.Wait()
+		})
+	}
+}
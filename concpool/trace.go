@@ -0,0 +1,36 @@
+package concpool
+
+import "runtime"
+
+// maxSubmissionFrames is how many frames WithSubmissionTrace records.
+const maxSubmissionFrames = 32
+
+// captureStack returns the program counters of the calling goroutine's
+// stack if the pool records submission traces, or nil otherwise. skip is
+// as for runtime.Callers, counting captureStack's caller as 1.
+func (p *Pool) captureStack(skip int) []uintptr {
+	if !p.submissionTrace {
+		return nil
+	}
+	pcs := make([]uintptr, maxSubmissionFrames)
+	n := runtime.Callers(skip+1, pcs)
+	return pcs[:n]
+}
+
+// SubmissionFrames resolves SubmissionStack into frames, innermost first,
+// starting with the pool method the task was submitted through. It returns
+// nil unless the pool was created with WithSubmissionTrace.
+func (r TaskResult) SubmissionFrames() []runtime.Frame {
+	if len(r.SubmissionStack) == 0 {
+		return nil
+	}
+	frames := runtime.CallersFrames(r.SubmissionStack)
+	var out []runtime.Frame
+	for {
+		f, more := frames.Next()
+		out = append(out, f)
+		if !more {
+			return out
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package concpool
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func submitFromKnownFunction(p *Pool) uint64 {
+	return p.Run(func() error { return errors.New("failed") })
+}
+
+func TestSubmissionTrace(t *testing.T) {
+	p := New(WithSubmissionTrace())
+	id := submitFromKnownFunction(p)
+	r := p.WaitMap()[id]
+
+	frames := r.SubmissionFrames()
+	if len(frames) < 2 {
+		t.Fatalf("SubmissionFrames() = %d frames, want at least 2", len(frames))
+	}
+	if !strings.HasSuffix(frames[0].Function, ".(*Pool).Run") {
+		t.Errorf("innermost frame is %s, want the pool method", frames[0].Function)
+	}
+	if !strings.HasSuffix(frames[1].Function, ".submitFromKnownFunction") {
+		t.Errorf("caller frame is %s, want submitFromKnownFunction", frames[1].Function)
+	}
+
+	q := New()
+	id = q.Run(func() error { return nil })
+	if r := q.WaitMap()[id]; r.SubmissionStack != nil || r.SubmissionFrames() != nil {
+		t.Error("pool without WithSubmissionTrace recorded a stack")
+	}
+}
+
+func BenchmarkSubmissionTrace(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"disabled", nil},
+		{"enabled", []Option{WithSubmissionTrace()}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			p := New(tc.opts...)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				p.Run(func() error { return nil })
+			}
+			b.StopTimer()
+			p.Wait()
+		})
+	}
+}
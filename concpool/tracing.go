@@ -0,0 +1,64 @@
+package concpool
+
+import "context"
+
+// Tracer starts the spans a pool created with WithTracing records for its
+// tasks. It is a subset of what tracing libraries offer, so the package
+// doesn't depend on one; package oteltracer adapts an OpenTelemetry
+// trace.Tracer to it.
+type Tracer interface {
+	// StartSpan starts a span named name as a child of the span in ctx,
+	// if any, and returns a context carrying the new span.
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	SetAttribute(key string, value any)
+	RecordError(err error)
+	End()
+}
+
+// taskSpanName is the name of the span recorded for each task.
+const taskSpanName = "concpool.task"
+
+// WithTracing makes the pool record a span named "concpool.task" with
+// tracer for every task submitted with ContextualRun or RunWithContext, as
+// a child of the span in the task's context. The span lasts while the task
+// runs, carries its ID as "task.id" and its name, if any, as "task.name",
+// and records the error it returns.
+func WithTracing(tracer Tracer) Option {
+	return func(p *Pool) {
+		p.tracer = tracer
+	}
+}
+
+// ContextualRun submits a task that is bound to ctx like RunWithContext
+// and gets a context when it runs: ctx itself, or with WithTracing a child
+// of it carrying the task's span, so the task's own spans nest under it.
+func (p *Pool) ContextualRun(ctx context.Context, task func(context.Context) error) uint64 {
+	t := &job{ctx: ctx}
+	t.fn = func() error { return p.runTraced(t, task) }
+	return p.submit(t)
+}
+
+// runTraced calls task with t's context, inside a span if the pool has a
+// tracer.
+func (p *Pool) runTraced(t *job, task func(context.Context) error) error {
+	if p.tracer == nil {
+		return task(t.ctx)
+	}
+
+	ctx, span := p.tracer.StartSpan(t.ctx, taskSpanName)
+	defer span.End()
+	span.SetAttribute("task.id", t.id)
+	if t.name != "" {
+		span.SetAttribute("task.name", t.name)
+	}
+
+	err := task(ctx)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
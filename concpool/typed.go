@@ -0,0 +1,67 @@
+package concpool
+
+import "sync"
+
+// TypedTaskResult is the outcome of a task run by a TypedPool. Value holds
+// whatever the task returned, even when it also returned an error.
+type TypedTaskResult[T any] struct {
+	ID      uint64
+	Success bool
+	Value   T
+	Err     error
+}
+
+// TypedPool is a Pool whose tasks return a value alongside their error.
+// Use NewTyped to create one, Run to submit tasks, and WaitTyped to collect
+// the typed results.
+type TypedPool[T any] struct {
+	pool *Pool
+
+	mu     sync.Mutex
+	values map[uint64]*T
+}
+
+// NewTyped creates a TypedPool that runs up to maxCount tasks concurrently.
+func NewTyped[T any](maxCount int) *TypedPool[T] {
+	return &TypedPool[T]{
+		pool:   NewSimple(maxCount),
+		values: make(map[uint64]*T),
+	}
+}
+
+// Run submits a task to the pool and returns its ID, which is also
+// reported in the task's TypedTaskResult.
+func (p *TypedPool[T]) Run(task func() (T, error)) uint64 {
+	value := new(T)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id := p.pool.Run(func() error {
+		v, err := task()
+		*value = v
+		return err
+	})
+	p.values[id] = value
+	return id
+}
+
+// WaitTyped blocks until all submitted tasks have finished and returns
+// their results in the order they completed.
+func (p *TypedPool[T]) WaitTyped() []TypedTaskResult[T] {
+	results := p.pool.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	typed := make([]TypedTaskResult[T], 0, len(results))
+	for _, r := range results {
+		tr := TypedTaskResult[T]{ID: r.ID, Success: r.Success, Err: r.Err}
+		if v, ok := p.values[r.ID]; ok {
+			tr.Value = *v
+			delete(p.values, r.ID)
+		}
+		typed = append(typed, tr)
+	}
+	return typed
+}
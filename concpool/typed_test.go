@@ -0,0 +1,47 @@
+package concpool
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestTypedPoolString(t *testing.T) {
+	p := NewTyped[string](3)
+	want := make(map[uint64]string)
+	for i := 0; i < 20; i++ {
+		s := strconv.Itoa(i)
+		want[p.Run(func() (string, error) { return "value-" + s, nil })] = "value-" + s
+	}
+	results := p.WaitTyped()
+	if len(results) != len(want) {
+		t.Fatalf("WaitTyped() returned %d results, want %d", len(results), len(want))
+	}
+	for _, r := range results {
+		if !r.Success || r.Value != want[r.ID] {
+			t.Errorf("task %d: got %+v, want value %q", r.ID, r, want[r.ID])
+		}
+	}
+}
+
+func TestTypedPoolInt(t *testing.T) {
+	errOdd := errors.New("odd")
+	p := NewTyped[int](2)
+	for i := 0; i < 10; i++ {
+		p.Run(func() (int, error) {
+			if i%2 == 1 {
+				return i, errOdd
+			}
+			return i * i, nil
+		})
+	}
+	for _, r := range p.WaitTyped() {
+		i := int(r.ID) - 1
+		switch {
+		case i%2 == 1 && (r.Success || !errors.Is(r.Err, errOdd)):
+			t.Errorf("task %d: got %+v, want failure with %v", r.ID, r, errOdd)
+		case i%2 == 0 && (!r.Success || r.Value != i*i):
+			t.Errorf("task %d: got %+v, want value %d", r.ID, r, i*i)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package concpool
+
+import "time"
+
+// workerSet is the group of long-lived worker goroutines serving a pool.
+// A pool starts workers on demand, up to its concurrency limit, and keeps
+// them around between tasks instead of spawning a goroutine per task. When
+// the pool terminates the set is retired and a fresh one is started the next
+// time work arrives. All fields are guarded by the pool's mutex.
+type workerSet struct {
+	// work hands jobs to idle workers. It is unbuffered: a dispatcher only
+	// sends on it after reserving an idle worker, so the send completes as
+	// soon as that worker is back in its receive.
+	work chan *job
+	// quit is closed when the set is retired.
+	quit chan struct{}
+
+	workers int
+	idle    int
+}
+
+func newWorkerSet() *workerSet {
+	return &workerSet{
+		work: make(chan *job),
+		quit: make(chan struct{}),
+	}
+}
+
+// dispatch hands every job in start to a worker, reusing idle workers
+// before starting new ones. The jobs must already have been counted as
+// running. Must not be called with p.mu held.
+func (p *Pool) dispatch(start []*job) {
+	if len(start) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	ws := p.workerSet()
+	var handoff []*job
+	for _, t := range start {
+		if ws.idle > 0 {
+			ws.idle--
+			handoff = append(handoff, t)
+			continue
+		}
+		ws.workers++
+		p.spawn(func() { p.worker(ws, t) })
+	}
+	p.mu.Unlock()
+
+	for _, t := range handoff {
+		select {
+		case ws.work <- t:
+		case <-ws.quit:
+			// the pool was shut down underneath us and has already
+			// reported the job; just give back its slot
+			p.mu.Lock()
+			p.finish(t)
+			p.mu.Unlock()
+		}
+	}
+}
+
+// Prewarm starts up to n workers ahead of time, capped at the pool's
+// concurrency, so the first submissions don't pay for spawning goroutines.
+// Workers that already exist count towards n, so calling it again is a
+// no-op. Prewarmed workers sit idle until there is work and exit when the
+// pool terminates, like any other worker.
+func (p *Pool) Prewarm(n int) {
+	p.lazyInit()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.prewarm(n)
+}
+
+// prewarm starts idle workers until there are n, as Prewarm does. The
+// caller must hold p.mu.
+func (p *Pool) prewarm(n int) {
+	if n > p.maxCount {
+		n = p.maxCount
+	}
+	if p.terminated || n <= 0 {
+		return
+	}
+	ws := p.workerSet()
+	for ws.workers < n {
+		ws.workers++
+		ws.idle++
+		p.spawn(func() { p.worker(ws, nil) })
+	}
+}
+
+// workerSet returns the current worker set, creating it if needed. The
+// caller must hold p.mu.
+func (p *Pool) workerSet() *workerSet {
+	if p.workers == nil {
+		p.workers = newWorkerSet()
+		if p.scaler != nil {
+			quit := p.workers.quit
+			p.spawn(func() { p.scaler.run(p, quit) })
+		}
+	}
+	return p.workers
+}
+
+// worker runs t and then keeps taking jobs, first straight from the queue
+// and otherwise from ws.work, until the set is retired or, with
+// WithIdleTimeout, it has been idle for too long. A nil t starts the worker
+// idle.
+func (p *Pool) worker(ws *workerSet, t *job) {
+	var idleTimer *time.Timer
+	for {
+		if t == nil {
+			var expired <-chan time.Time
+			if p.idleTimeout > 0 {
+				if idleTimer == nil {
+					idleTimer = time.NewTimer(p.idleTimeout)
+				} else {
+					idleTimer.Reset(p.idleTimeout)
+				}
+				expired = idleTimer.C
+			}
+
+			select {
+			case t = <-ws.work:
+			case <-ws.quit:
+				p.mu.Lock()
+				ws.idle--
+				ws.workers--
+				p.mu.Unlock()
+				return
+			case <-expired:
+				// with no idle worker to spare, a dispatcher has
+				// reserved this one and is about to hand it a job;
+				// WithMinWorkers keeps the last few around regardless
+				p.mu.Lock()
+				exit := ws.idle > 0 && ws.workers > p.minWorkers
+				if exit {
+					ws.idle--
+					ws.workers--
+				}
+				p.mu.Unlock()
+				if exit {
+					return
+				}
+				continue
+			}
+			if idleTimer != nil {
+				idleTimer.Stop()
+			}
+		}
+
+		p.execute(t)
+
+		p.mu.Lock()
+		p.finish(t)
+		next := p.next()
+		retire := next == nil && ws.workers > p.maxCount
+		if retire {
+			ws.workers--
+		} else if next == nil {
+			ws.idle++
+		}
+		onIdle := p.takeIdleCallback()
+		p.mu.Unlock()
+
+		// let the event loop collect results or notice the pool is idle
+		p.attemptCheck()
+		if onIdle != nil {
+			onIdle()
+		}
+
+		if retire {
+			return
+		}
+		t = next
+	}
+}
+
+// finish frees the worker slot held by t. The caller must hold p.mu.
+func (p *Pool) finish(t *job) {
+	w := t.cost()
+	p.running -= w
+	delete(p.inflight, t.id)
+	if w > 1 {
+		p.slotFreed.Broadcast()
+	} else {
+		p.slotFreed.Signal()
+	}
+}
+
+// stopWorkers retires the current worker set so idle workers exit, along
+// with the OnResultBlocking goroutine. The caller must hold p.mu.
+func (p *Pool) stopWorkers() {
+	if p.workers != nil {
+		close(p.workers.quit)
+		p.workers = nil
+	}
+	if p.sink != nil {
+		close(p.sink.quit)
+		p.sink = nil
+		p.sinkPending = 0
+	}
+}
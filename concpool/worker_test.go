@@ -0,0 +1,222 @@
+package concpool
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkersAreReused(t *testing.T) {
+	const limit = 4
+	p := NewSimple(limit)
+	var mu sync.Mutex
+	sets := make(map[*workerSet]bool)
+	peak := 0
+	for i := 0; i < 1000; i++ {
+		p.Run(func() error {
+			p.mu.Lock()
+			ws := p.workers
+			n := ws.workers
+			p.mu.Unlock()
+
+			mu.Lock()
+			sets[ws] = true
+			peak = max(peak, n)
+			mu.Unlock()
+			return nil
+		})
+	}
+	if results := p.Wait(); len(results) != 1000 {
+		t.Fatalf("got %d results, want 1000", len(results))
+	}
+	if len(sets) != 1 || peak > limit {
+		t.Fatalf("1000 tasks used %d worker sets and up to %d workers, want 1 set of at most %d", len(sets), peak, limit)
+	}
+	if p.workers != nil {
+		t.Fatal("workers were not retired when the pool terminated")
+	}
+}
+
+// BenchmarkThroughput runs a million short tasks through the pool, and
+// through the goroutine-per-task design it replaced: a goroutine is spawned
+// for every task and sends its result to a collector, as Wait used to.
+func BenchmarkThroughput(b *testing.B) {
+	const tasks = 1000000
+	task := func() error { return nil }
+	b.Run("workers", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			p := NewDefault()
+			for j := 0; j < tasks; j++ {
+				p.Run(task)
+			}
+			p.Wait()
+		}
+		b.ReportMetric(float64(b.N)*tasks/b.Elapsed().Seconds(), "tasks/s")
+	})
+	b.Run("goroutine per task", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+			results := make(chan TaskResult, 1)
+			collected := make(chan []TaskResult)
+			go func() {
+				var all []TaskResult
+				for r := range results {
+					all = append(all, r)
+				}
+				collected <- all
+			}()
+			var wg sync.WaitGroup
+			for j := 0; j < tasks; j++ {
+				sem <- struct{}{}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					started := time.Now()
+					err := task()
+					results <- TaskResult{ID: uint64(j + 1), Index: j, Success: err == nil, Err: err, StartedAt: started, Duration: time.Since(started)}
+					<-sem
+				}()
+			}
+			wg.Wait()
+			close(results)
+			<-collected
+		}
+		b.ReportMetric(float64(b.N)*tasks/b.Elapsed().Seconds(), "tasks/s")
+	})
+}
+
+func TestPrewarm(t *testing.T) {
+	tests := []struct {
+		name  string
+		calls []int
+		want  int
+	}{
+		{"starts n", []int{3}, 3},
+		{"idempotent", []int{5, 5}, 5},
+		{"clamped to the limit", []int{100}, 8},
+		{"never shrinks", []int{6, 2}, 6},
+		{"none", []int{0}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewSimple(8)
+			for _, n := range tt.calls {
+				p.Prewarm(n)
+			}
+			p.mu.Lock()
+			workers, idle := 0, 0
+			if p.workers != nil {
+				workers, idle = p.workers.workers, p.workers.idle
+			}
+			p.mu.Unlock()
+			if workers != tt.want || idle != tt.want {
+				t.Fatalf("%d workers, %d idle; want %d idle workers", workers, idle, tt.want)
+			}
+
+			p.RunN(20, func() error { return nil })
+			if results := p.Wait(); len(results) != 20 {
+				t.Fatalf("got %d results, want 20", len(results))
+			}
+		})
+	}
+}
+
+// BenchmarkFirstTask measures how long a fresh pool takes to start its
+// first task, with and without its workers started ahead of time.
+func BenchmarkFirstTask(b *testing.B) {
+	for _, prewarm := range []bool{false, true} {
+		b.Run(fmt.Sprintf("prewarm=%v", prewarm), func(b *testing.B) {
+			var latency time.Duration
+			for i := 0; i < b.N; i++ {
+				p := NewSimple(8)
+				if prewarm {
+					p.Prewarm(8)
+				}
+				var started time.Time
+				submitted := time.Now()
+				p.Run(func() error { started = time.Now(); return nil })
+				p.Wait()
+				latency += started.Sub(submitted)
+			}
+			b.ReportMetric(float64(latency.Nanoseconds())/float64(b.N), "ns/first-task")
+		})
+	}
+}
+
+// waitGoroutines polls until the pool reports want goroutines, and returns
+// the last count seen.
+func waitGoroutines(p *Pool, want int) int {
+	deadline := time.Now().Add(5 * time.Second)
+	n := p.Stats().Goroutines
+	for n != want && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		n = p.Stats().Goroutines
+	}
+	return n
+}
+
+func TestIdleTimeout(t *testing.T) {
+	p := New(WithMaxConcurrency(8), WithIdleTimeout(100*time.Millisecond))
+	release := p.Hold()
+	done := make(chan []TaskResult)
+	go func() { done <- p.Wait() }()
+
+	// two bursts, so workers started after the first quiet period exit too
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 40; i++ {
+			p.Run(func() error { time.Sleep(5 * time.Millisecond); return nil })
+		}
+		if n := waitGoroutines(p, 8); n != 8 {
+			t.Fatalf("round %d: %d workers during the burst, want 8", round, n)
+		}
+		busy := runtime.NumGoroutine()
+		if n := waitGoroutines(p, 0); n != 0 {
+			t.Fatalf("round %d: %d workers still alive after the idle timeout", round, n)
+		}
+		// other tests' goroutines may exit meanwhile, but none start
+		if quiet := runtime.NumGoroutine(); quiet > busy-8 {
+			t.Errorf("round %d: %d goroutines after the idle timeout, %d during the burst", round, quiet, busy)
+		}
+	}
+	release()
+	if results := <-done; len(results) != 80 {
+		t.Fatalf("Wait() = %d results, want 80", len(results))
+	}
+}
+
+func TestMinWorkers(t *testing.T) {
+	const minWorkers = 3
+	p := New(WithMaxConcurrency(8), WithMinWorkers(minWorkers), WithIdleTimeout(50*time.Millisecond))
+	if n := p.Stats().Goroutines; n != minWorkers {
+		t.Fatalf("%d workers after New, want %d started eagerly", n, minWorkers)
+	}
+	release := p.Hold()
+	done := make(chan []TaskResult)
+	go func() { done <- p.Wait() }()
+	for i := 0; i < 40; i++ {
+		p.Run(func() error { time.Sleep(5 * time.Millisecond); return nil })
+	}
+	if n := waitGoroutines(p, 8); n != 8 {
+		t.Fatalf("%d workers during the burst, want 8", n)
+	}
+	// the extra workers time out; the minimum stays
+	if n := waitGoroutines(p, minWorkers); n != minWorkers {
+		t.Fatalf("%d workers after the idle timeout, want %d", n, minWorkers)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := p.Stats().Goroutines; n != minWorkers {
+		t.Errorf("%d workers after two more idle timeouts, want %d", n, minWorkers)
+	}
+	release()
+	<-done
+
+	// Reset starts the minimum again after termination stopped them
+	p.Reset()
+	if n := waitGoroutines(p, minWorkers); n != minWorkers {
+		t.Errorf("%d workers after Reset, want %d", n, minWorkers)
+	}
+}
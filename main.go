@@ -9,7 +9,7 @@ import (
 
 // This example program demonstrates using the concpool.Pool package.
 func main() {
-	pool := concpool.New(10)
+	pool := concpool.New(concpool.WithMaxConcurrency(10))
 	var counter uint64
 	var mu sync.Mutex
 